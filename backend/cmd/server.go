@@ -1,48 +1,156 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
-	"io"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/bans"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/certs"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/chat"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/config"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/matches"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/profiles"
 	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket"
 )
 
-var addr = flag.String("addr", ":8080", "http service address")
-var verbose = flag.Bool("verbose", false, "enable verbose debug logging")
-var tickInterval = flag.Int("tick-interval", 50, "tick interval in milliseconds (default: 50ms, which is 20Hz)")
-var maxTicks = flag.Uint64("max-ticks", 100000, "maximum number of ticks in a game session (default: 100000 ticks, ~30 mins at 20Hz)")
-var resetTimeout = flag.Int("reset-timeout", 30, "time in seconds to wait between game sessions (default: 30 seconds)")
-var staticDir = flag.String("static-dir", "./public", "directory for serving static files (default: ./public)")
-
-// debugLogger is a logger that only logs when verbose mode is enabled
-type debugLogger struct {
-	logger  *log.Logger
-	enabled bool
-}
+// Built-in defaults, shown in the flag help. Every flag mirrors a config
+// setting of the same name and only overrides the config file and
+// environment when it is set explicitly, see loadConfig.
+var defaults = config.Default()
+
+var configFile = flag.String("config", "", "path to a YAML or JSON config file (env: BLOBBERMAN_CONFIG)")
+var preset = flag.String("preset", "", "named preset to apply: default, quick, slow, fast, test or one defined in the config file")
+var addr = flag.String("addr", defaults.Addr, "http service address")
+var logLevel = flag.String("log-level", defaults.LogLevel, "minimum log level: debug, info, warn or error")
+var logFormat = flag.String("log-format", defaults.LogFormat, "log output format: text or json")
+var tickInterval = flag.Int("tick-interval", defaults.TickIntervalMs, "tick interval in milliseconds (50ms is 20Hz)")
+var maxTicks = flag.Uint64("max-ticks", defaults.MaxTicks, "maximum number of ticks in a game session (100000 ticks is ~30 mins at 20Hz)")
+var resetTimeout = flag.Int("reset-timeout", defaults.ResetTimeoutSec, "time in seconds to wait between game sessions")
+var minPlayers = flag.Int("min-players", defaults.MinPlayers, "players needed before the start countdown of a match begins")
+var waitingTimeout = flag.Int("waiting-timeout", defaults.WaitingTimeoutSec, "seconds to wait for min-players before starting with fewer, 0 to wait for them")
+var startCountdown = flag.Int("start-countdown", defaults.StartCountdownSec, "seconds of countdown before a match starts, 0 to start at once")
+var resetPause = flag.Int("reset-pause", defaults.ResetPauseSec, "seconds between clearing a finished match and waiting for players again")
+var idlePolicy = flag.String("idle-policy", defaults.IdlePolicy, "what to do with a match when all clients leave: keep or reset")
+var staticDir = flag.String("static-dir", defaults.StaticDir, "directory for serving static files")
+var shutdownTimeout = flag.Int("shutdown-timeout", defaults.ShutdownTimeoutSec, "seconds to wait for clients to disconnect on shutdown")
+var reconnectDelay = flag.Int("reconnect-delay", defaults.ReconnectDelaySec, "seconds clients are told to wait before reconnecting after a shutdown")
+var resultsFile = flag.String("results-file", defaults.ResultsFile, "file the results of finished matches are appended to, results only last until the server stops if empty")
+var playersFile = flag.String("players-file", defaults.PlayersFile, "file the lifetime statistics of players are kept in, they only last until the server stops if empty")
+var banFile = flag.String("ban-file", defaults.BanFile, "file the ban list is kept in, bans only last until the server stops if empty")
+var adminToken = flag.String("admin-token", defaults.AdminToken, "bearer token of the admin API at /api/admin/, the API is disabled if empty")
+var stateFile = flag.String("state-file", defaults.StateFile, "file the running match is saved to on shutdown and restored from on startup")
+var announcement = flag.String("announcement", defaults.Announcement, "announcement text shown to players")
+var allowedOrigins = flag.String("allowed-origins", "", "comma-separated origins allowed to open WebSocket connections, e.g. https://*.example.com")
+var trustedProxies = flag.String("trusted-proxies", "", "comma-separated reverse proxy IPs or CIDR ranges whose Forwarded and X-Forwarded-For headers are honored")
+var maxConnsPerIP = flag.Int("max-connections-per-ip", defaults.MaxConnsPerIP, "maximum concurrent connections from one client IP, 0 for no limit")
+var connsPerMinute = flag.Int("connections-per-minute", defaults.ConnsPerMinute, "maximum new connections from one client IP per minute, 0 for no limit")
+var requireHello = flag.Bool("require-hello", defaults.RequireHello, "refuse clients still speaking the legacy protocol without a hello")
+var legacySessions = flag.Bool("legacy-sessions", defaults.LegacySessions, "let legacy clients claim an online player's ID without its session token")
+var compression = flag.Bool("compression", defaults.Compression, "negotiate permessage-deflate with clients that support it")
+var maxSpectators = flag.Int("max-spectators", defaults.MaxSpectators, "maximum number of spectators, 0 for no limit")
+var spectatorDelay = flag.Int("spectator-delay", defaults.SpectatorDelaySec, "seconds the delayed spectator feed at /ws/delayed lags behind the match, 0 to disable it")
+var reconnectGrace = flag.Int("reconnect-grace", defaults.ReconnectGraceSec, "seconds a disconnected player's slot is held for them to reconnect, 0 to release it at once")
+var maxPlayers = flag.Int("max-players", defaults.MaxPlayers, "maximum number of players in the match, further players wait in a join queue, 0 for no limit")
+var priorityTokens = flag.String("priority-tokens", "", "comma-separated tokens letting players skip ahead of the join queue")
+var afkWarning = flag.Int("afk-warning", defaults.AFKWarningSec, "seconds without movement before a player is warned, 0 to never warn")
+var afkTimeout = flag.Int("afk-timeout", defaults.AFKTimeoutSec, "seconds without movement before the afk-action is taken, 0 to never take it")
+var afkAction = flag.String("afk-action", defaults.AFKAction, "what happens to idle players: spectate or disconnect")
+var nameMaxLength = flag.Int("name-max-length", defaults.NameMaxLength, "maximum length of a display name in characters")
+var reservedNames = flag.String("reserved-names", "", "comma-separated display names players may not pick, compared case-insensitively")
+var chatMaxLength = flag.Int("chat-max-length", defaults.ChatMaxLength, "maximum length of a chat message in characters")
+var chatRateLimit = flag.Int("chat-rate-limit", defaults.ChatRateLimit, "chat messages a player may send per chat-rate-window, 0 for no limit")
+var chatRateWindow = flag.Int("chat-rate-window", defaults.ChatRateWindowSec, "seconds over which chat-rate-limit applies")
+var chatHistory = flag.Int("chat-history", defaults.ChatHistory, "number of recent chat messages sent to players joining late")
+var chatBlockedWords = flag.String("chat-blocked-words", "", "comma-separated words masked in chat messages")
+var chatBlockedPatterns = flag.String("chat-blocked-patterns", "", "comma-separated regular expressions blocking matching chat messages")
+var tlsCert = flag.String("tls-cert", defaults.TLSCert, "TLS certificate file, serves HTTPS and wss:// when set together with -tls-key")
+var tlsKey = flag.String("tls-key", defaults.TLSKey, "TLS private key file")
+var redirectAddr = flag.String("redirect-addr", defaults.RedirectAddr, "address of an optional plain HTTP listener that redirects to HTTPS, e.g. :80")
+var devMode = flag.Bool("dev-mode", defaults.DevMode, "accept WebSocket connections from any origin (for local development)")
 
-// newDebugLogger creates a new debug logger
-func newDebugLogger(enabled bool) *debugLogger {
-	var logger *log.Logger
-	if enabled {
-		logger = log.New(os.Stdout, "[DEBUG] ", log.LstdFlags)
-	} else {
-		logger = log.New(io.Discard, "", 0)
+// newLogger creates the structured logger for the given output format, its
+// minimum level is read from the level variable so it can change at runtime
+func newLogger(level *slog.LevelVar, format string) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stdout, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be text or json", format)
 	}
-	return &debugLogger{
-		logger:  logger,
-		enabled: enabled,
+}
+
+// setLogLevel parses and applies a log level
+func setLogLevel(level *slog.LevelVar, value string) error {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(value)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", value, err)
 	}
+	level.Set(minLevel)
+	return nil
 }
 
-// Printf prints debug messages if verbose is enabled
-func (d *debugLogger) Printf(format string, args ...interface{}) {
-	if d.enabled {
-		d.logger.Printf(format, args...)
+// hubOptions creates the hub options for a configuration
+func hubOptions(cfg *config.Config) (websocket.HubOptions, error) {
+	patternFilter, err := chat.NewPatternFilter(cfg.ChatBlockedPatterns)
+	if err != nil {
+		return websocket.HubOptions{}, err
 	}
+	trustedProxies, err := websocket.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return websocket.HubOptions{}, err
+	}
+
+	return websocket.HubOptions{
+		TickIntervalMs:    cfg.TickIntervalMs,
+		MaxHistorySize:    cfg.MaxTicks,
+		ResetTimeoutSec:   cfg.ResetTimeoutSec,
+		MinPlayers:        cfg.MinPlayers,
+		WaitingTimeoutSec: cfg.WaitingTimeoutSec,
+		StartCountdownSec: cfg.StartCountdownSec,
+		ResetPauseSec:     cfg.ResetPauseSec,
+		IdlePolicy:        websocket.IdlePolicy(cfg.IdlePolicy),
+		Announcement:      cfg.Announcement,
+		AllowedOrigins:    cfg.AllowedOrigins,
+		DevMode:           cfg.DevMode,
+		TrustedProxies:    trustedProxies,
+		MaxConnsPerIP:     cfg.MaxConnsPerIP,
+		ConnsPerMinute:    cfg.ConnsPerMinute,
+		AdminToken:        cfg.AdminToken,
+		RequireHello:      cfg.RequireHello,
+		LegacySessions:    cfg.LegacySessions,
+		Compression:       cfg.Compression,
+		MaxSpectators:     cfg.MaxSpectators,
+		SpectatorDelay:    cfg.SpectatorDelaySec,
+		ReconnectGrace:    cfg.ReconnectGraceSec,
+		MaxPlayers:        cfg.MaxPlayers,
+		PriorityTokens:    cfg.PriorityTokens,
+		AFKWarningSec:     cfg.AFKWarningSec,
+		AFKTimeoutSec:     cfg.AFKTimeoutSec,
+		AFKAction:         websocket.AFKAction(cfg.AFKAction),
+		NameMaxLength:     cfg.NameMaxLength,
+		ReservedNames:     cfg.ReservedNames,
+		Chat: chat.Options{
+			MaxLength:   cfg.ChatMaxLength,
+			RateLimit:   cfg.ChatRateLimit,
+			RateWindow:  time.Duration(cfg.ChatRateWindowSec) * time.Second,
+			HistorySize: cfg.ChatHistory,
+			Filters:     []chat.Filter{patternFilter, chat.NewWordFilter(cfg.ChatBlockedWords)},
+		},
+	}, nil
 }
 
 // spaHandler implements a handler for serving a Single Page Application
@@ -85,29 +193,78 @@ func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.FileServer(http.Dir(h.staticPath)).ServeHTTP(w, r)
 }
 
+// loadConfig loads the configuration file and environment, with any
+// explicitly set flags taking precedence
+func loadConfig() (*config.Config, error) {
+	overrides := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			overrides[f.Name] = f.Value.String()
+		}
+	})
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv(config.EnvName("config"))
+	}
+
+	return config.Load(path, overrides)
+}
+
 func main() {
 	flag.Parse()
 
-	// Set up debug logger
-	debugLog := newDebugLogger(*verbose)
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	if *verbose {
-		log.Printf("Verbose logging enabled")
-		log.Printf("Tick interval: %dms", *tickInterval)
-		log.Printf("Max ticks: %d", *maxTicks)
-		log.Printf("Reset timeout: %d seconds", *resetTimeout)
-		log.Printf("Static files directory: %s", *staticDir)
+	// Set up the structured logger, also used by anything still calling the log package
+	level := &slog.LevelVar{}
+	if err := setLogLevel(level, cfg.LogLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger, err := newLogger(level, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	slog.SetDefault(logger)
 
-	// Create options for the hub
-	hubOptions := websocket.HubOptions{
-		TickIntervalMs:  *tickInterval,
-		MaxHistorySize:  *maxTicks,
-		ResetTimeoutSec: *resetTimeout,
+	logger.Info("Effective configuration", "config", cfg)
+
+	// Create a new hub with the structured logger
+	options, err := hubOptions(cfg)
+	if err != nil {
+		logger.Error("Invalid hub options", "error", err)
+		os.Exit(2)
+	}
+	options.Bans, err = bans.Open(cfg.BanFile)
+	if err != nil {
+		logger.Error("Failed to load ban list", "path", cfg.BanFile, "error", err)
+		os.Exit(1)
+	}
+	options.Matches, err = matches.Open(cfg.ResultsFile)
+	if err != nil {
+		logger.Error("Failed to load results history", "path", cfg.ResultsFile, "error", err)
+		os.Exit(1)
+	}
+	options.Profiles, err = profiles.Open(cfg.PlayersFile)
+	if err != nil {
+		logger.Error("Failed to load player profiles", "path", cfg.PlayersFile, "error", err)
+		os.Exit(1)
+	}
+	hub := websocket.NewHubWithOptions(options, logger)
+
+	// Resume the match saved by the last graceful shutdown, if any
+	if cfg.StateFile != "" {
+		if err := hub.LoadState(cfg.StateFile); err != nil {
+			logger.Error("Failed to restore match state", "path", cfg.StateFile, "error", err)
+		}
 	}
 
-	// Create a new hub with debug logger
-	hub := websocket.NewHubWithOptions(hubOptions, debugLog.Printf)
 	go hub.Run()
 
 	// Create the API mux (for WebSocket and API endpoints)
@@ -115,31 +272,225 @@ func main() {
 
 	// Setup WebSocket handler
 	apiMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		remoteAddr := r.RemoteAddr
-		debugLog.Printf("New websocket connection request from %s", remoteAddr)
-		websocket.HandleWebSocketWithDebug(hub, w, r, debugLog.Printf)
+		logger.Debug("New websocket connection request", "remoteAddr", r.RemoteAddr)
+		websocket.HandleWebSocketWithDebug(hub, w, r, logger)
+	})
+
+	// Delayed spectator feed for casters and streamers
+	apiMux.HandleFunc("/ws/delayed", func(w http.ResponseWriter, r *http.Request) {
+		logger.Debug("New delayed feed connection request", "remoteAddr", r.RemoteAddr)
+		websocket.HandleDelayedWebSocket(hub, w, r, logger)
 	})
 
+	// Admin API, disabled unless an admin token is configured
+	apiMux.Handle("/api/admin/", websocket.AdminHandler(hub, logger))
+
+	// Results history of finished matches
+	apiMux.Handle("/api/matches", websocket.MatchesHandler(hub, logger))
+	apiMux.Handle("/api/matches/", websocket.MatchesHandler(hub, logger))
+
+	// Player profiles and leaderboards
+	apiMux.Handle("/api/players", websocket.PlayersHandler(hub, logger))
+	apiMux.Handle("/api/players/", websocket.PlayersHandler(hub, logger))
+
 	// Add a simple health check endpoint
 	apiMux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("OK"))
 	})
 
+	// Expose hub metrics in the Prometheus text format
+	apiMux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		websocket.HandleMetrics(hub, w, r)
+	})
+
 	// Create the main mux
 	mainMux := http.NewServeMux()
 
 	// Mount API handlers to /api/ path
 	mainMux.Handle("/ws", apiMux)
+	mainMux.Handle("/ws/delayed", apiMux)
 	mainMux.Handle("/health", apiMux)
+	mainMux.Handle("/metrics", apiMux)
+	mainMux.Handle("/api/", apiMux)
 
 	// Set up static file serving with SPA support
-	spa := spaHandler{staticPath: *staticDir, indexPath: "index.html"}
+	spa := spaHandler{staticPath: cfg.StaticDir, indexPath: "index.html"}
 	mainMux.Handle("/", spa)
 
-	log.Printf("Starting server on %s", *addr)
-	log.Printf("Serving static files from %s", *staticDir)
-	err := http.ListenAndServe(*addr, mainMux)
+	server := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: mainMux,
+	}
+	servers := []*http.Server{server}
+
+	// Serve TLS directly when a certificate is configured, reloading it
+	// whenever the certificate files change
+	if cfg.TLSCert != "" {
+		reloader, err := certs.NewReloader(cfg.TLSCert, cfg.TLSKey, logger)
+		if err != nil {
+			logger.Error("Failed to load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Loaded TLS certificate", "certFile", cfg.TLSCert, "notAfter", reloader.NotAfter())
+
+		server.TLSConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	// Stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting server", "addr", cfg.Addr, "staticDir", cfg.StaticDir, "tls", server.TLSConfig != nil)
+		if server.TLSConfig != nil {
+			serverErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	// Redirect plain HTTP requests to HTTPS
+	if cfg.RedirectAddr != "" {
+		redirectServer := &http.Server{
+			Addr:    cfg.RedirectAddr,
+			Handler: httpsRedirect(cfg.Addr),
+		}
+		servers = append(servers, redirectServer)
+
+		go func() {
+			logger.Info("Starting HTTP to HTTPS redirect", "addr", cfg.RedirectAddr)
+			serverErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	// Reload the configuration on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for ctx.Err() == nil {
+		select {
+		case err := <-serverErr:
+			logger.Error("ListenAndServe failed", "error", err)
+			os.Exit(1)
+		case <-hup:
+			cfg = reloadConfig(cfg, hub, level, logger)
+		case <-ctx.Done():
+		}
+	}
+
+	// A second signal kills the process straight away
+	stop()
+	shutdown(servers, hub, cfg, logger)
+}
+
+// httpsRedirect redirects every request to the same URL over HTTPS on the
+// port of the TLS listener address
+func httpsRedirect(tlsAddr string) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+}
+
+// reloadConfig re-reads the configuration and applies the settings that are
+// safe to change while matches are running, returning the new effective
+// configuration. If the new configuration is invalid the current one is kept.
+func reloadConfig(current *config.Config, hub *websocket.Hub, level *slog.LevelVar, logger *slog.Logger) *config.Config {
+	logger.Info("Reloading configuration")
+
+	cfg, err := loadConfig()
 	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+		logger.Error("Failed to reload configuration, keeping the current one", "error", err)
+		return current
+	}
+
+	// Settings used to set up the listener, static files and logger only
+	// take effect after a restart
+	restartOnly := []struct {
+		key     string
+		current string
+		next    *string
+	}{
+		{"addr", current.Addr, &cfg.Addr},
+		{"static-dir", current.StaticDir, &cfg.StaticDir},
+		{"log-format", current.LogFormat, &cfg.LogFormat},
+		{"state-file", current.StateFile, &cfg.StateFile},
+		{"ban-file", current.BanFile, &cfg.BanFile},
+		{"results-file", current.ResultsFile, &cfg.ResultsFile},
+		{"players-file", current.PlayersFile, &cfg.PlayersFile},
+		{"tls-cert", current.TLSCert, &cfg.TLSCert},
+		{"tls-key", current.TLSKey, &cfg.TLSKey},
+		{"redirect-addr", current.RedirectAddr, &cfg.RedirectAddr},
+	}
+	for _, setting := range restartOnly {
+		if *setting.next != setting.current {
+			logger.Warn("Setting can't change without a restart, ignoring it", "setting", setting.key, "value", *setting.next)
+			*setting.next = setting.current
+		}
 	}
+
+	options, err := hubOptions(cfg)
+	if err != nil {
+		logger.Error("Failed to reload configuration, keeping the current one", "error", err)
+		return current
+	}
+
+	if err := setLogLevel(level, cfg.LogLevel); err != nil {
+		logger.Error("Failed to apply log level", "error", err)
+	}
+
+	hub.Reconfigure(options)
+
+	// Pick up bans added to the ban file by hand
+	if err := hub.ReloadBans(); err != nil {
+		logger.Error("Failed to reload ban list, keeping the current one", "error", err)
+	}
+
+	logger.Info("Reloaded configuration", "config", cfg)
+	return cfg
+}
+
+// shutdown stops accepting connections, tells every client the server is
+// going away, flushes the match state and closes all connections, giving up
+// once the configured shutdown timeout has passed
+func shutdown(servers []*http.Server, hub *websocket.Hub, cfg *config.Config, logger *slog.Logger) {
+	timeout := time.Duration(cfg.ShutdownTimeoutSec) * time.Second
+	logger.Info("Shutting down", "timeoutSec", cfg.ShutdownTimeoutSec)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Stop accepting new connections, WebSocket connections are hijacked so
+	// this doesn't wait for them
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("HTTP server did not shut down cleanly", "addr", server.Addr, "error", err)
+		}
+	}
+
+	if err := hub.Shutdown(ctx, cfg.ReconnectDelaySec); err != nil {
+		logger.Warn("Not all clients disconnected before the shutdown timeout", "error", err)
+	}
+
+	if cfg.StateFile != "" {
+		if err := hub.SaveState(cfg.StateFile); err != nil {
+			logger.Error("Failed to save match state", "path", cfg.StateFile, "error", err)
+		}
+	}
+
+	logger.Info("Server stopped")
 }
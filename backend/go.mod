@@ -3,6 +3,9 @@ module github.com/chrisfarms/vibes/blobberman/backend
 go 1.23.5
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.3
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/text v0.22.0
@@ -0,0 +1,262 @@
+// Package bans implements a ban list kept in a local file, banning players
+// by their player ID or by IP address or CIDR range, each ban with a reason
+// and an optional expiry.
+package bans
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/atomicfile"
+)
+
+// Reasons a ban is refused or can't be found
+var (
+	ErrNoTarget    = errors.New("ban needs either a player ID or an IP address")
+	ErrManyTargets = errors.New("ban can't have both a player ID and an IP address")
+	ErrInvalidIP   = errors.New("ban IP is not an IP address or CIDR range")
+	ErrExpired     = errors.New("ban expires in the past")
+	ErrNotFound    = errors.New("ban not found")
+)
+
+// Ban keeps a player ID or an IP address or range out of the server
+type Ban struct {
+	ID        string     `json:"id"`
+	PlayerID  string     `json:"playerId,omitempty"` // Banned player ID
+	IP        string     `json:"ip,omitempty"`       // Banned IP address or CIDR range
+	Reason    string     `json:"reason,omitempty"`   // Shown to the banned client and in the logs
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // Nil for a permanent ban
+
+	prefix netip.Prefix // Parsed IP, for matching addresses
+}
+
+// Expired reports whether the ban has run out at the given time
+func (b Ban) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+// matches reports whether the ban covers a player ID or an IP address
+func (b Ban) matches(playerID string, ip netip.Addr) bool {
+	if b.PlayerID != "" {
+		return playerID != "" && b.PlayerID == playerID
+	}
+	return ip.IsValid() && b.prefix.Contains(ip)
+}
+
+// parsePrefix parses a ban IP, either a single address or a CIDR range
+func parsePrefix(ip string) (netip.Prefix, error) {
+	if strings.Contains(ip, "/") {
+		prefix, err := netip.ParsePrefix(ip)
+		if err != nil {
+			return netip.Prefix{}, ErrInvalidIP
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}, ErrInvalidIP
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// file is the format of the ban file
+type file struct {
+	Bans []Ban `json:"bans"`
+}
+
+// Store holds the ban list, saving every change to its file
+type Store struct {
+	mutex sync.Mutex
+	path  string // Empty to keep the bans in memory only
+	bans  []Ban
+}
+
+// Open loads the ban list from a file, starting an empty one if the file
+// doesn't exist yet. With an empty path the bans are only kept in memory.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the ban file again, picking up changes made to it by hand
+func (s *Store) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading ban file: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("error parsing ban file: %w", err)
+	}
+	for i := range f.Bans {
+		if f.Bans[i].ID == "" {
+			f.Bans[i].ID = newID()
+		}
+		if err := f.Bans[i].validate(); err != nil {
+			return fmt.Errorf("invalid ban %q in ban file: %w", f.Bans[i].ID, err)
+		}
+	}
+
+	s.mutex.Lock()
+	s.bans = f.Bans
+	s.mutex.Unlock()
+	return nil
+}
+
+// validate checks the ban has exactly one target and parses its IP
+func (b *Ban) validate() error {
+	switch {
+	case b.PlayerID == "" && b.IP == "":
+		return ErrNoTarget
+	case b.PlayerID != "" && b.IP != "":
+		return ErrManyTargets
+	case b.IP != "":
+		prefix, err := parsePrefix(b.IP)
+		if err != nil {
+			return err
+		}
+		b.prefix = prefix
+		b.IP = prefix.String()
+		if prefix.IsSingleIP() {
+			b.IP = prefix.Addr().String()
+		}
+	}
+	return nil
+}
+
+// Add adds a ban to the list and saves it, returning the ban with its ID
+// and creation time filled in
+func (s *Store) Add(ban Ban) (Ban, error) {
+	ban.PlayerID = strings.TrimSpace(ban.PlayerID)
+	ban.IP = strings.TrimSpace(ban.IP)
+	if err := ban.validate(); err != nil {
+		return Ban{}, err
+	}
+
+	now := time.Now()
+	if ban.Expired(now) {
+		return Ban{}, ErrExpired
+	}
+	ban.ID = newID()
+	ban.CreatedAt = now
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.bans
+	s.bans = append(s.active(now), ban)
+	if err := s.save(); err != nil {
+		s.bans = previous
+		return Ban{}, err
+	}
+	return ban, nil
+}
+
+// Remove lifts a ban and saves the list, returning the ban that was removed
+func (s *Store) Remove(id string) (Ban, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.bans
+	bans := s.active(time.Now())
+	for i, ban := range bans {
+		if ban.ID == id {
+			s.bans = append(bans[:i:i], bans[i+1:]...)
+			if err := s.save(); err != nil {
+				s.bans = previous
+				return Ban{}, err
+			}
+			return ban, nil
+		}
+	}
+	return Ban{}, ErrNotFound
+}
+
+// List returns the bans in force, oldest first
+func (s *Store) List() []Ban {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bans := s.active(time.Now())
+	sort.SliceStable(bans, func(i, j int) bool { return bans[i].CreatedAt.Before(bans[j].CreatedAt) })
+	return bans
+}
+
+// Match returns the ban in force covering a player ID or an IP address, if
+// any, either may be empty
+func (s *Store) Match(playerID string, ip string) (Ban, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err == nil {
+		addr = addr.Unmap()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for _, ban := range s.bans {
+		if !ban.Expired(now) && ban.matches(playerID, addr) {
+			return ban, true
+		}
+	}
+	return Ban{}, false
+}
+
+// active returns a copy of the bans that haven't expired, the mutex must be
+// held
+func (s *Store) active(now time.Time) []Ban {
+	bans := make([]Ban, 0, len(s.bans))
+	for _, ban := range s.bans {
+		if !ban.Expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return bans
+}
+
+// save writes the ban list to its file, replacing it atomically, the mutex
+// must be held
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(file{Bans: s.bans}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling bans: %w", err)
+	}
+
+	if err := atomicfile.Write(s.path, data); err != nil {
+		return fmt.Errorf("error saving ban file: %w", err)
+	}
+	return nil
+}
+
+// newID creates a random ban ID
+func newID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
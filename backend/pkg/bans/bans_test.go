@@ -0,0 +1,150 @@
+package bans
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	path := filepath.Join(t.TempDir(), "bans.json")
+	data, err := json.Marshal(file{Bans: []Ban{
+		{ID: "player", PlayerID: "cheater", Reason: "cheating"},
+		{ID: "single", IP: "203.0.113.7"},
+		{ID: "range", IP: "198.51.100.0/24", ExpiresAt: &future},
+		{ID: "v6range", IP: "2001:db8::/32"},
+		{ID: "expired", IP: "192.0.2.0/24", ExpiresAt: &past},
+		{ID: "expiredplayer", PlayerID: "reformed", ExpiresAt: &past},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		playerID string
+		ip       string
+		want     string // ID of the matching ban, empty for none
+	}{
+		{name: "banned player", playerID: "cheater", ip: "10.0.0.1", want: "player"},
+		{name: "banned player without IP", playerID: "cheater", want: "player"},
+		{name: "other player", playerID: "honest", ip: "10.0.0.1"},
+		{name: "nobody", ip: "10.0.0.1"},
+		{name: "single address", ip: "203.0.113.7", want: "single"},
+		{name: "next to single address", ip: "203.0.113.8"},
+		{name: "start of range", ip: "198.51.100.0", want: "range"},
+		{name: "end of range", ip: "198.51.100.255", want: "range"},
+		{name: "outside range", ip: "198.51.101.1"},
+		{name: "IPv4-mapped address in range", ip: "::ffff:198.51.100.9", want: "range"},
+		{name: "IPv6 range", ip: "2001:db8:1::1", want: "v6range"},
+		{name: "outside IPv6 range", ip: "2001:db9::1"},
+		{name: "expired range", ip: "192.0.2.10"},
+		{name: "expired player", playerID: "reformed", ip: "10.0.0.1"},
+		{name: "invalid IP", playerID: "honest", ip: "not-an-ip"},
+		{name: "empty player ID doesn't match player bans", playerID: "", ip: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ban, banned := store.Match(tt.playerID, tt.ip)
+			if banned != (tt.want != "") || ban.ID != tt.want {
+				t.Errorf("Match(%q, %q) = %q, %v, want %q", tt.playerID, tt.ip, ban.ID, banned, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		ban     Ban
+		wantIP  string
+		matchIP string // Address the added ban covers
+		wantErr error
+	}{
+		{name: "player", ban: Ban{PlayerID: " cheater "}},
+		{name: "address", ban: Ban{IP: "203.0.113.7"}, wantIP: "203.0.113.7", matchIP: "203.0.113.7"},
+		{name: "mapped address", ban: Ban{IP: "::ffff:203.0.113.7"}, wantIP: "203.0.113.7", matchIP: "203.0.113.7"},
+		{name: "range masked", ban: Ban{IP: "198.51.100.17/24"}, wantIP: "198.51.100.0/24", matchIP: "198.51.100.42"},
+		{name: "no target", ban: Ban{Reason: "nothing"}, wantErr: ErrNoTarget},
+		{name: "both targets", ban: Ban{PlayerID: "cheater", IP: "203.0.113.7"}, wantErr: ErrManyTargets},
+		{name: "invalid address", ban: Ban{IP: "203.0.113"}, wantErr: ErrInvalidIP},
+		{name: "invalid range", ban: Ban{IP: "198.51.100.0/33"}, wantErr: ErrInvalidIP},
+		{name: "already expired", ban: Ban{PlayerID: "cheater", ExpiresAt: &past}, wantErr: ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := Open("")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ban, err := store.Add(tt.ban)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Add error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(store.List()) != 0 {
+					t.Error("refused ban was added to the list")
+				}
+				return
+			}
+			if ban.ID == "" || ban.CreatedAt.IsZero() {
+				t.Errorf("added ban has no ID or creation time: %+v", ban)
+			}
+			if ban.IP != tt.wantIP {
+				t.Errorf("IP = %q, want %q", ban.IP, tt.wantIP)
+			}
+			if _, banned := store.Match("cheater", tt.matchIP); !banned {
+				t.Error("added ban doesn't match its own target")
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ban, err := store.Add(Ban{IP: "198.51.100.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Remove("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removing a missing ban: error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := store.Remove(ban.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, banned := store.Match("", "198.51.100.1"); banned {
+		t.Error("removed ban still matches")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bans := reopened.List(); len(bans) != 0 {
+		t.Errorf("ban file still has %d bans after removal", len(bans))
+	}
+}
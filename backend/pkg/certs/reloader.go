@@ -0,0 +1,118 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the certificate files are checked for changes
+const checkInterval = time.Second
+
+// Reloader serves a TLS certificate loaded from a certificate and key file,
+// reloading it when either file changes so certificates can be rotated
+// without restarting the server
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	certStamp fileStamp
+	keyStamp  fileStamp
+	lastCheck time.Time
+}
+
+// fileStamp identifies a version of a file by its modification time and size
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader loads the certificate and key, failing if they can't be used
+func NewReloader(certFile string, keyFile string, logger *slog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger.With("certFile", certFile, "keyFile", keyFile),
+	}
+
+	certStamp, keyStamp, err := r.stamps()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(certStamp, keyStamp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.lastCheck) >= checkInterval {
+		r.lastCheck = time.Now()
+		r.reloadIfChanged()
+	}
+	return r.cert, nil
+}
+
+// reloadIfChanged reloads the certificate if either file has changed, keeping
+// the current one if the new files can't be loaded, for example because only
+// one of them has been replaced so far
+func (r *Reloader) reloadIfChanged() {
+	certStamp, keyStamp, err := r.stamps()
+	if err != nil {
+		r.logger.Warn("Failed to check certificate files", "error", err)
+		return
+	}
+	if certStamp == r.certStamp && keyStamp == r.keyStamp {
+		return
+	}
+
+	if err := r.load(certStamp, keyStamp); err != nil {
+		r.logger.Warn("Failed to reload certificate, keeping the current one", "error", err)
+		return
+	}
+	r.logger.Info("Reloaded TLS certificate", "notAfter", r.NotAfter())
+}
+
+// NotAfter returns the expiry time of the current certificate
+func (r *Reloader) NotAfter() time.Time {
+	if r.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return r.cert.Leaf.NotAfter
+}
+
+// load reads the certificate and key and records the file versions they came from
+func (r *Reloader) load(certStamp fileStamp, keyStamp fileStamp) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.certStamp = certStamp
+	r.keyStamp = keyStamp
+	return nil
+}
+
+// stamps returns the current versions of the certificate and key files
+func (r *Reloader) stamps() (fileStamp, fileStamp, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fileStamp{}, fileStamp{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fileStamp{}, fileStamp{}, err
+	}
+	return fileStamp{certInfo.ModTime(), certInfo.Size()}, fileStamp{keyInfo.ModTime(), keyInfo.Size()}, nil
+}
@@ -0,0 +1,172 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate and its key, with the given
+// serial number and modification time
+func writeCert(t *testing.T, certFile string, keyFile string, serial int64, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Duration(serial) * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), modTime)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), modTime)
+}
+
+// writeFile writes a file and sets its modification time, so a change is
+// seen even within the file system's timestamp resolution
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedSerial gets the certificate through GetCertificate and returns its
+// serial number, letting it check the files again straight away if recheck
+// is set rather than waiting for the check interval
+func servedSerial(t *testing.T, r *Reloader, recheck bool) int64 {
+	t.Helper()
+
+	r.mutex.Lock()
+	if recheck {
+		r.lastCheck = time.Time{}
+	} else {
+		r.lastCheck = time.Now()
+	}
+	r.mutex.Unlock()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	writeCert(t, certFile, keyFile, 1, start)
+	r, err := NewReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, r, true); serial != 1 {
+		t.Fatalf("serving certificate %d, want 1", serial)
+	}
+
+	// A rotated certificate is picked up
+	writeCert(t, certFile, keyFile, 2, start.Add(time.Minute))
+	if serial := servedSerial(t, r, true); serial != 2 {
+		t.Fatalf("serving certificate %d after rotation, want 2", serial)
+	}
+
+	// Checks are rate limited, so files changed since the last check are
+	// only picked up once the check interval has passed
+	writeCert(t, certFile, keyFile, 3, start.Add(2*time.Minute))
+	if serial := servedSerial(t, r, false); serial != 2 {
+		t.Errorf("serving certificate %d before the check interval passed, want 2", serial)
+	}
+	if serial := servedSerial(t, r, true); serial != 3 {
+		t.Fatalf("serving certificate %d after the check interval, want 3", serial)
+	}
+}
+
+func TestReloaderKeepsCertificateOnBrokenReplacement(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	writeCert(t, certFile, keyFile, 1, start)
+	r, err := NewReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A certificate that isn't PEM at all
+	writeFile(t, certFile, []byte("not a certificate"), start.Add(time.Minute))
+	if serial := servedSerial(t, r, true); serial != 1 {
+		t.Fatalf("serving certificate %d after a broken replacement, want 1", serial)
+	}
+
+	// Only the certificate replaced so far, not matching the key
+	otherDir := t.TempDir()
+	writeCert(t, filepath.Join(otherDir, "cert.pem"), filepath.Join(otherDir, "key.pem"), 2, start)
+	data, err := os.ReadFile(filepath.Join(otherDir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, data, start.Add(2*time.Minute))
+	if serial := servedSerial(t, r, true); serial != 1 {
+		t.Fatalf("serving certificate %d with a mismatched key, want 1", serial)
+	}
+
+	// Missing files
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, r, true); serial != 1 {
+		t.Fatalf("serving certificate %d with the key missing, want 1", serial)
+	}
+}
+
+func TestNewReloaderFails(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if _, err := NewReloader(certFile, keyFile, logger); err == nil {
+		t.Error("loaded missing certificate files")
+	}
+
+	writeFile(t, certFile, []byte("not a certificate"), time.Now())
+	writeFile(t, keyFile, []byte("not a key"), time.Now())
+	if _, err := NewReloader(certFile, keyFile, logger); err == nil {
+		t.Error("loaded an invalid certificate")
+	}
+}
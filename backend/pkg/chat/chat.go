@@ -0,0 +1,157 @@
+// Package chat implements in-game text chat: length and rate limits,
+// pluggable moderation filters and a history of recent messages for players
+// joining late.
+package chat
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// Reasons a chat message is refused
+var (
+	ErrEmpty       = errors.New("message is empty")
+	ErrTooLong     = errors.New("message is too long")
+	ErrRateLimited = errors.New("sending messages too quickly")
+	ErrBlocked     = errors.New("message was blocked by a filter")
+)
+
+// Options configures a chat room
+type Options struct {
+	MaxLength   int           // Maximum message length in characters
+	RateLimit   int           // Messages a player may send per RateWindow, zero for no limit
+	RateWindow  time.Duration // Window over which RateLimit applies
+	HistorySize int           // Number of recent messages kept for late joiners
+	Filters     []Filter      // Applied in order to every message
+}
+
+// Chat validates, moderates and records the chat messages of one match
+type Chat struct {
+	mutex   sync.Mutex
+	options Options
+	buckets map[string]*bucket
+	history []types.ChatMessage
+}
+
+// New creates a chat room with the given options
+func New(options Options) *Chat {
+	return &Chat{
+		options: options,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Reconfigure applies new options, keeping the history and rate limit state
+func (c *Chat) Reconfigure(options Options) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.options = options
+	c.trimHistory()
+}
+
+// Post checks a message from a player against the limits and filters and
+// records it, returning the message to broadcast
+func (c *Chat) Post(playerID string, text string, tick uint64, now time.Time) (types.ChatMessage, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return types.ChatMessage{}, ErrEmpty
+	}
+	if c.options.MaxLength > 0 && utf8.RuneCountInString(text) > c.options.MaxLength {
+		return types.ChatMessage{}, ErrTooLong
+	}
+
+	if c.options.RateLimit > 0 {
+		b, ok := c.buckets[playerID]
+		if !ok {
+			b = &bucket{tokens: float64(c.options.RateLimit), updated: now}
+			c.buckets[playerID] = b
+		}
+		if !b.take(c.options.RateLimit, c.options.RateWindow, now) {
+			return types.ChatMessage{}, ErrRateLimited
+		}
+	}
+
+	for _, filter := range c.options.Filters {
+		var err error
+		if text, err = filter.Apply(text); err != nil {
+			return types.ChatMessage{}, err
+		}
+	}
+
+	message := types.ChatMessage{
+		Type:     types.MessageTypeChat,
+		PlayerID: playerID,
+		Text:     text,
+		Tick:     tick,
+		SentAt:   now.UnixMilli(),
+	}
+	c.history = append(c.history, message)
+	c.trimHistory()
+
+	return message, nil
+}
+
+// History returns a copy of the recent messages, oldest first
+func (c *Chat) History() []types.ChatMessage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]types.ChatMessage(nil), c.history...)
+}
+
+// Restore replaces the history, for a match restored from saved state
+func (c *Chat) Restore(history []types.ChatMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.history = append([]types.ChatMessage(nil), history...)
+	c.trimHistory()
+}
+
+// Reset clears the history and rate limits when a new match starts
+func (c *Chat) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.history = nil
+	c.buckets = make(map[string]*bucket)
+}
+
+// trimHistory drops the oldest messages beyond the history size, the mutex
+// must be held
+func (c *Chat) trimHistory() {
+	if excess := len(c.history) - c.options.HistorySize; excess > 0 {
+		c.history = append([]types.ChatMessage(nil), c.history[excess:]...)
+	}
+}
+
+// bucket is a token bucket limiting how often a player may send messages
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills the bucket for the time since it was last used and takes a
+// token if one is available
+func (b *bucket) take(limit int, window time.Duration, now time.Time) bool {
+	if window > 0 {
+		elapsed := now.Sub(b.updated)
+		b.tokens = min(float64(limit), b.tokens+float64(limit)*elapsed.Seconds()/window.Seconds())
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
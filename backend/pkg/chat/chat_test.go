@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPostRateLimit(t *testing.T) {
+	type send struct {
+		player  string
+		at      time.Duration // Since the first message
+		wantErr error
+	}
+
+	tests := []struct {
+		name   string
+		limit  int
+		window time.Duration
+		sends  []send
+	}{
+		{
+			name:   "burst up to the limit",
+			limit:  3,
+			window: 3 * time.Second,
+			sends: []send{
+				{player: "a", at: 0},
+				{player: "a", at: 0},
+				{player: "a", at: 0},
+				{player: "a", at: 0, wantErr: ErrRateLimited},
+			},
+		},
+		{
+			name:   "refills over the window",
+			limit:  3,
+			window: 3 * time.Second,
+			sends: []send{
+				{player: "a", at: 0},
+				{player: "a", at: 0},
+				{player: "a", at: 0},
+				{player: "a", at: 500 * time.Millisecond, wantErr: ErrRateLimited},
+				{player: "a", at: 1500 * time.Millisecond},
+				{player: "a", at: 1500 * time.Millisecond, wantErr: ErrRateLimited},
+				{player: "a", at: 10 * time.Second},
+				{player: "a", at: 10 * time.Second},
+				{player: "a", at: 10 * time.Second},
+				{player: "a", at: 10 * time.Second, wantErr: ErrRateLimited},
+			},
+		},
+		{
+			name:   "limited per player",
+			limit:  1,
+			window: time.Second,
+			sends: []send{
+				{player: "a", at: 0},
+				{player: "a", at: 0, wantErr: ErrRateLimited},
+				{player: "b", at: 0},
+				{player: "b", at: 0, wantErr: ErrRateLimited},
+			},
+		},
+		{
+			name:   "refused messages cost nothing",
+			limit:  1,
+			window: time.Second,
+			sends: []send{
+				{player: "a", at: 0},
+				{player: "a", at: 100 * time.Millisecond, wantErr: ErrRateLimited},
+				{player: "a", at: 200 * time.Millisecond, wantErr: ErrRateLimited},
+				{player: "a", at: time.Second},
+			},
+		},
+		{
+			name:   "no limit",
+			limit:  0,
+			window: time.Second,
+			sends: []send{
+				{player: "a", at: 0},
+				{player: "a", at: 0},
+				{player: "a", at: 0},
+				{player: "a", at: 0},
+			},
+		},
+	}
+
+	start := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(Options{MaxLength: 200, RateLimit: tt.limit, RateWindow: tt.window, HistorySize: 50})
+			for i, s := range tt.sends {
+				_, err := c.Post(s.player, "hello", 0, start.Add(s.at))
+				if !errors.Is(err, s.wantErr) {
+					t.Errorf("message %d from %s at %v: error = %v, want %v", i, s.player, s.at, err, s.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestPostResetClearsRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := New(Options{RateLimit: 1, RateWindow: time.Minute, HistorySize: 10})
+
+	if _, err := c.Post("a", "hello", 0, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Post("a", "hello", 0, now); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("second message error = %v, want %v", err, ErrRateLimited)
+	}
+
+	c.Reset()
+	if _, err := c.Post("a", "hello", 0, now); err != nil {
+		t.Errorf("message after reset error = %v, want none", err)
+	}
+}
+
+func TestPostValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr error
+	}{
+		{name: "trimmed", text: "  hi  ", want: "hi"},
+		{name: "empty", text: "   ", wantErr: ErrEmpty},
+		{name: "at the limit", text: "ééééé", want: "ééééé"},
+		{name: "too long", text: "abcdef", wantErr: ErrTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(Options{MaxLength: 5, HistorySize: 10})
+			message, err := c.Post("a", tt.text, 7, time.Now())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if message.Text != tt.want {
+				t.Errorf("text = %q, want %q", message.Text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter moderates chat messages
+//
+// Apply returns the text to send, which may have been altered, or an error
+// if the message must not be sent at all. Returning ErrBlocked, or an error
+// wrapping it, tells the player their message was blocked.
+type Filter interface {
+	Apply(text string) (string, error)
+}
+
+// FilterFunc adapts a function to the Filter interface
+type FilterFunc func(text string) (string, error)
+
+// Apply calls f(text)
+func (f FilterFunc) Apply(text string) (string, error) {
+	return f(text)
+}
+
+// NewWordFilter creates a filter that masks each of the given words with
+// asterisks, matching whole words regardless of case
+func NewWordFilter(words []string) Filter {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return FilterFunc(func(text string) (string, error) { return text, nil })
+	}
+
+	pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return FilterFunc(func(text string) (string, error) {
+		return pattern.ReplaceAllStringFunc(text, func(word string) string {
+			return strings.Repeat("*", len([]rune(word)))
+		}), nil
+	})
+}
+
+// NewPatternFilter creates a filter that blocks messages matching any of the
+// given regular expressions
+func NewPatternFilter(patterns []string) (Filter, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chat pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	return FilterFunc(func(text string) (string, error) {
+		for _, re := range compiled {
+			if re.MatchString(text) {
+				return "", ErrBlocked
+			}
+		}
+		return text, nil
+	}), nil
+}
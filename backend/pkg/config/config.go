@@ -0,0 +1,585 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables that configure the server
+const EnvPrefix = "BLOBBERMAN_"
+
+// Config holds the effective server configuration
+//
+// Every setting has a kebab-case key which is used for the config file, the
+// command-line flag of the same name and the BLOBBERMAN_* environment
+// variable (upper-cased, with dashes replaced by underscores).
+type Config struct {
+	Addr                string            `json:"addr" yaml:"addr"`
+	StaticDir           string            `json:"static-dir" yaml:"static-dir"`
+	LogLevel            string            `json:"log-level" yaml:"log-level"`
+	LogFormat           string            `json:"log-format" yaml:"log-format"`
+	TickIntervalMs      int               `json:"tick-interval" yaml:"tick-interval"`
+	MaxTicks            uint64            `json:"max-ticks" yaml:"max-ticks"`
+	ResetTimeoutSec     int               `json:"reset-timeout" yaml:"reset-timeout"`
+	MinPlayers          int               `json:"min-players" yaml:"min-players"`
+	WaitingTimeoutSec   int               `json:"waiting-timeout" yaml:"waiting-timeout"`
+	StartCountdownSec   int               `json:"start-countdown" yaml:"start-countdown"`
+	ResetPauseSec       int               `json:"reset-pause" yaml:"reset-pause"`
+	IdlePolicy          string            `json:"idle-policy" yaml:"idle-policy"`
+	ShutdownTimeoutSec  int               `json:"shutdown-timeout" yaml:"shutdown-timeout"`
+	ReconnectDelaySec   int               `json:"reconnect-delay" yaml:"reconnect-delay"`
+	StateFile           string            `json:"state-file" yaml:"state-file"`
+	BanFile             string            `json:"ban-file" yaml:"ban-file"`
+	ResultsFile         string            `json:"results-file" yaml:"results-file"`
+	PlayersFile         string            `json:"players-file" yaml:"players-file"`
+	AdminToken          string            `json:"admin-token" yaml:"admin-token"`
+	Announcement        string            `json:"announcement" yaml:"announcement"`
+	AllowedOrigins      []string          `json:"allowed-origins" yaml:"allowed-origins"`
+	DevMode             bool              `json:"dev-mode" yaml:"dev-mode"`
+	TrustedProxies      []string          `json:"trusted-proxies" yaml:"trusted-proxies"`
+	MaxConnsPerIP       int               `json:"max-connections-per-ip" yaml:"max-connections-per-ip"`
+	ConnsPerMinute      int               `json:"connections-per-minute" yaml:"connections-per-minute"`
+	RequireHello        bool              `json:"require-hello" yaml:"require-hello"`
+	LegacySessions      bool              `json:"legacy-sessions" yaml:"legacy-sessions"`
+	Compression         bool              `json:"compression" yaml:"compression"`
+	MaxSpectators       int               `json:"max-spectators" yaml:"max-spectators"`
+	SpectatorDelaySec   int               `json:"spectator-delay" yaml:"spectator-delay"`
+	ReconnectGraceSec   int               `json:"reconnect-grace" yaml:"reconnect-grace"`
+	MaxPlayers          int               `json:"max-players" yaml:"max-players"`
+	PriorityTokens      []string          `json:"priority-tokens" yaml:"priority-tokens"`
+	AFKWarningSec       int               `json:"afk-warning" yaml:"afk-warning"`
+	AFKTimeoutSec       int               `json:"afk-timeout" yaml:"afk-timeout"`
+	AFKAction           string            `json:"afk-action" yaml:"afk-action"`
+	NameMaxLength       int               `json:"name-max-length" yaml:"name-max-length"`
+	ReservedNames       []string          `json:"reserved-names" yaml:"reserved-names"`
+	ChatMaxLength       int               `json:"chat-max-length" yaml:"chat-max-length"`
+	ChatRateLimit       int               `json:"chat-rate-limit" yaml:"chat-rate-limit"`
+	ChatRateWindowSec   int               `json:"chat-rate-window" yaml:"chat-rate-window"`
+	ChatHistory         int               `json:"chat-history" yaml:"chat-history"`
+	ChatBlockedWords    []string          `json:"chat-blocked-words" yaml:"chat-blocked-words"`
+	ChatBlockedPatterns []string          `json:"chat-blocked-patterns" yaml:"chat-blocked-patterns"`
+	TLSCert             string            `json:"tls-cert" yaml:"tls-cert"`
+	TLSKey              string            `json:"tls-key" yaml:"tls-key"`
+	RedirectAddr        string            `json:"redirect-addr" yaml:"redirect-addr"`
+	Preset              string            `json:"preset" yaml:"preset"`
+	Presets             map[string]Preset `json:"presets" yaml:"presets"`
+}
+
+// Preset is a named set of game settings applied on top of the defaults
+//
+// Settings left unset keep their default value. Values from the config file,
+// environment and flags are applied after the preset, so they always win.
+type Preset struct {
+	TickIntervalMs    *int    `json:"tick-interval,omitempty" yaml:"tick-interval,omitempty"`
+	MaxTicks          *uint64 `json:"max-ticks,omitempty" yaml:"max-ticks,omitempty"`
+	ResetTimeoutSec   *int    `json:"reset-timeout,omitempty" yaml:"reset-timeout,omitempty"`
+	LogLevel          *string `json:"log-level,omitempty" yaml:"log-level,omitempty"`
+	AFKWarningSec     *int    `json:"afk-warning,omitempty" yaml:"afk-warning,omitempty"`
+	AFKTimeoutSec     *int    `json:"afk-timeout,omitempty" yaml:"afk-timeout,omitempty"`
+	MaxPlayers        *int    `json:"max-players,omitempty" yaml:"max-players,omitempty"`
+	MinPlayers        *int    `json:"min-players,omitempty" yaml:"min-players,omitempty"`
+	StartCountdownSec *int    `json:"start-countdown,omitempty" yaml:"start-countdown,omitempty"`
+}
+
+// apply copies the preset's settings onto the config
+func (p Preset) apply(c *Config) {
+	if p.TickIntervalMs != nil {
+		c.TickIntervalMs = *p.TickIntervalMs
+	}
+	if p.MaxTicks != nil {
+		c.MaxTicks = *p.MaxTicks
+	}
+	if p.ResetTimeoutSec != nil {
+		c.ResetTimeoutSec = *p.ResetTimeoutSec
+	}
+	if p.LogLevel != nil {
+		c.LogLevel = *p.LogLevel
+	}
+	if p.AFKWarningSec != nil {
+		c.AFKWarningSec = *p.AFKWarningSec
+	}
+	if p.AFKTimeoutSec != nil {
+		c.AFKTimeoutSec = *p.AFKTimeoutSec
+	}
+	if p.MaxPlayers != nil {
+		c.MaxPlayers = *p.MaxPlayers
+	}
+	if p.MinPlayers != nil {
+		c.MinPlayers = *p.MinPlayers
+	}
+	if p.StartCountdownSec != nil {
+		c.StartCountdownSec = *p.StartCountdownSec
+	}
+}
+
+// Default returns the built-in configuration, including the standard presets
+func Default() *Config {
+	return &Config{
+		Addr:               ":8080",
+		StaticDir:          "./public",
+		LogLevel:           "info",
+		LogFormat:          "text",
+		TickIntervalMs:     50,     // 20Hz
+		MaxTicks:           100000, // ~30 mins at 20Hz
+		ResetTimeoutSec:    30,
+		MinPlayers:         1,
+		StartCountdownSec:  5,
+		ResetPauseSec:      2,
+		IdlePolicy:         "keep",
+		ShutdownTimeoutSec: 10,
+		ReconnectDelaySec:  5,
+		Compression:        true,
+		LegacySessions:     true, // Until the served frontend sends session tokens
+		MaxSpectators:      100,
+		SpectatorDelaySec:  30,
+		ReconnectGraceSec:  30,
+		AFKWarningSec:      60,
+		AFKTimeoutSec:      120,
+		AFKAction:          "spectate",
+		NameMaxLength:      24,
+		ChatMaxLength:      200,
+		ChatRateLimit:      5,
+		ChatRateWindowSec:  10,
+		ChatHistory:        50,
+		Presets: map[string]Preset{
+			"default": {},
+			"quick": {
+				MaxTicks:          ptr[uint64](2000),
+				ResetTimeoutSec:   ptr(5),
+				StartCountdownSec: ptr(3),
+				AFKWarningSec:     ptr(20),
+				AFKTimeoutSec:     ptr(40),
+			},
+			"slow": {
+				TickIntervalMs: ptr(100),
+				MaxTicks:       ptr[uint64](8000),
+			},
+			"fast": {
+				MaxTicks:          ptr[uint64](1000),
+				ResetTimeoutSec:   ptr(5),
+				StartCountdownSec: ptr(3),
+				AFKWarningSec:     ptr(10),
+				AFKTimeoutSec:     ptr(20),
+			},
+			"test": {
+				MaxTicks:        ptr[uint64](500),
+				ResetTimeoutSec: ptr(5),
+				LogLevel:        ptr("debug"),
+			},
+		},
+	}
+}
+
+// setters parses a string value for each setting key, used for environment
+// variables and command-line flags
+var setters = map[string]func(c *Config, value string) error{
+	"addr":                   func(c *Config, v string) error { c.Addr = v; return nil },
+	"static-dir":             func(c *Config, v string) error { c.StaticDir = v; return nil },
+	"log-level":              func(c *Config, v string) error { c.LogLevel = v; return nil },
+	"log-format":             func(c *Config, v string) error { c.LogFormat = v; return nil },
+	"tick-interval":          func(c *Config, v string) error { return parseInt(v, &c.TickIntervalMs) },
+	"max-ticks":              func(c *Config, v string) error { return parseUint(v, &c.MaxTicks) },
+	"reset-timeout":          func(c *Config, v string) error { return parseInt(v, &c.ResetTimeoutSec) },
+	"min-players":            func(c *Config, v string) error { return parseInt(v, &c.MinPlayers) },
+	"waiting-timeout":        func(c *Config, v string) error { return parseInt(v, &c.WaitingTimeoutSec) },
+	"start-countdown":        func(c *Config, v string) error { return parseInt(v, &c.StartCountdownSec) },
+	"reset-pause":            func(c *Config, v string) error { return parseInt(v, &c.ResetPauseSec) },
+	"idle-policy":            func(c *Config, v string) error { c.IdlePolicy = v; return nil },
+	"shutdown-timeout":       func(c *Config, v string) error { return parseInt(v, &c.ShutdownTimeoutSec) },
+	"reconnect-delay":        func(c *Config, v string) error { return parseInt(v, &c.ReconnectDelaySec) },
+	"state-file":             func(c *Config, v string) error { c.StateFile = v; return nil },
+	"ban-file":               func(c *Config, v string) error { c.BanFile = v; return nil },
+	"results-file":           func(c *Config, v string) error { c.ResultsFile = v; return nil },
+	"players-file":           func(c *Config, v string) error { c.PlayersFile = v; return nil },
+	"admin-token":            func(c *Config, v string) error { c.AdminToken = v; return nil },
+	"announcement":           func(c *Config, v string) error { c.Announcement = v; return nil },
+	"allowed-origins":        func(c *Config, v string) error { c.AllowedOrigins = parseList(v); return nil },
+	"dev-mode":               func(c *Config, v string) error { return parseBool(v, &c.DevMode) },
+	"trusted-proxies":        func(c *Config, v string) error { c.TrustedProxies = parseList(v); return nil },
+	"max-connections-per-ip": func(c *Config, v string) error { return parseInt(v, &c.MaxConnsPerIP) },
+	"connections-per-minute": func(c *Config, v string) error { return parseInt(v, &c.ConnsPerMinute) },
+	"require-hello":          func(c *Config, v string) error { return parseBool(v, &c.RequireHello) },
+	"legacy-sessions":        func(c *Config, v string) error { return parseBool(v, &c.LegacySessions) },
+	"compression":            func(c *Config, v string) error { return parseBool(v, &c.Compression) },
+	"max-spectators":         func(c *Config, v string) error { return parseInt(v, &c.MaxSpectators) },
+	"spectator-delay":        func(c *Config, v string) error { return parseInt(v, &c.SpectatorDelaySec) },
+	"reconnect-grace":        func(c *Config, v string) error { return parseInt(v, &c.ReconnectGraceSec) },
+	"max-players":            func(c *Config, v string) error { return parseInt(v, &c.MaxPlayers) },
+	"priority-tokens":        func(c *Config, v string) error { c.PriorityTokens = parseList(v); return nil },
+	"afk-warning":            func(c *Config, v string) error { return parseInt(v, &c.AFKWarningSec) },
+	"afk-timeout":            func(c *Config, v string) error { return parseInt(v, &c.AFKTimeoutSec) },
+	"afk-action":             func(c *Config, v string) error { c.AFKAction = v; return nil },
+	"name-max-length":        func(c *Config, v string) error { return parseInt(v, &c.NameMaxLength) },
+	"reserved-names":         func(c *Config, v string) error { c.ReservedNames = parseList(v); return nil },
+	"chat-max-length":        func(c *Config, v string) error { return parseInt(v, &c.ChatMaxLength) },
+	"chat-rate-limit":        func(c *Config, v string) error { return parseInt(v, &c.ChatRateLimit) },
+	"chat-rate-window":       func(c *Config, v string) error { return parseInt(v, &c.ChatRateWindowSec) },
+	"chat-history":           func(c *Config, v string) error { return parseInt(v, &c.ChatHistory) },
+	"chat-blocked-words":     func(c *Config, v string) error { c.ChatBlockedWords = parseList(v); return nil },
+	"chat-blocked-patterns":  func(c *Config, v string) error { c.ChatBlockedPatterns = parseList(v); return nil },
+	"tls-cert":               func(c *Config, v string) error { c.TLSCert = v; return nil },
+	"tls-key":                func(c *Config, v string) error { c.TLSKey = v; return nil },
+	"redirect-addr":          func(c *Config, v string) error { c.RedirectAddr = v; return nil },
+	"preset":                 func(c *Config, v string) error { c.Preset = v; return nil },
+}
+
+// Set parses and stores the value of a single setting by its key
+func (c *Config) Set(key string, value string) error {
+	setter, ok := setters[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err := setter(c, value); err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", value, key, err)
+	}
+	return nil
+}
+
+// EnvName returns the environment variable name for a setting key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// Load builds the effective configuration
+//
+// Settings are layered, later layers winning: built-in defaults, the selected
+// preset, the config file at path (if any), BLOBBERMAN_* environment
+// variables and finally the overrides, which are the explicitly set flags.
+func Load(path string, overrides map[string]string) (*Config, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	// The file may define extra presets and select one, so read it once
+	// before applying the preset and again to override it
+	fileConfig := &Config{}
+	if err := decode(path, data, fileConfig); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+	for name, preset := range fileConfig.Presets {
+		c.Presets[name] = preset
+	}
+
+	preset := fileConfig.Preset
+	if value, ok := os.LookupEnv(EnvName("preset")); ok {
+		preset = value
+	}
+	if value, ok := overrides["preset"]; ok {
+		preset = value
+	}
+	if preset != "" {
+		p, ok := c.Presets[preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q (available: %s)", preset, strings.Join(c.PresetNames(), ", "))
+		}
+		p.apply(c)
+	}
+
+	if err := decode(path, data, c); err != nil {
+		return nil, err
+	}
+
+	for _, key := range Keys() {
+		if value, ok := os.LookupEnv(EnvName(key)); ok {
+			if err := c.Set(key, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", EnvName(key), err)
+			}
+		}
+	}
+
+	for key, value := range overrides {
+		if err := c.Set(key, value); err != nil {
+			return nil, fmt.Errorf("-%s: %w", key, err)
+		}
+	}
+	c.Preset = preset
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Keys returns the keys of all settings, sorted
+func Keys() []string {
+	keys := make([]string, 0, len(setters))
+	for key := range setters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PresetNames returns the names of all known presets, sorted
+func (c *Config) PresetNames() []string {
+	names := make([]string, 0, len(c.Presets))
+	for name := range c.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks the configuration for invalid or inconsistent settings
+func (c *Config) Validate() error {
+	var errs []error
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log-level must be debug, info, warn or error, got %q", c.LogLevel))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("log-format must be text or json, got %q", c.LogFormat))
+	}
+	if c.TickIntervalMs <= 0 {
+		errs = append(errs, fmt.Errorf("tick-interval must be positive, got %d", c.TickIntervalMs))
+	}
+	if c.MaxTicks == 0 {
+		errs = append(errs, errors.New("max-ticks must be positive"))
+	}
+	if c.ResetTimeoutSec <= 0 {
+		errs = append(errs, fmt.Errorf("reset-timeout must be positive, got %d", c.ResetTimeoutSec))
+	}
+	if c.MinPlayers < 1 {
+		errs = append(errs, fmt.Errorf("min-players must be at least 1, got %d", c.MinPlayers))
+	}
+	if c.WaitingTimeoutSec < 0 {
+		errs = append(errs, fmt.Errorf("waiting-timeout must not be negative, got %d", c.WaitingTimeoutSec))
+	}
+	if c.StartCountdownSec < 0 {
+		errs = append(errs, fmt.Errorf("start-countdown must not be negative, got %d", c.StartCountdownSec))
+	}
+	if c.ResetPauseSec < 0 {
+		errs = append(errs, fmt.Errorf("reset-pause must not be negative, got %d", c.ResetPauseSec))
+	}
+	if c.IdlePolicy != "keep" && c.IdlePolicy != "reset" {
+		errs = append(errs, fmt.Errorf("idle-policy must be keep or reset, got %q", c.IdlePolicy))
+	}
+	if c.ShutdownTimeoutSec <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown-timeout must be positive, got %d", c.ShutdownTimeoutSec))
+	}
+	if c.ReconnectDelaySec < 0 {
+		errs = append(errs, fmt.Errorf("reconnect-delay must not be negative, got %d", c.ReconnectDelaySec))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("trusted-proxies entry %q is not an IP address or CIDR range", proxy))
+			}
+		}
+	}
+	if c.MaxConnsPerIP < 0 {
+		errs = append(errs, fmt.Errorf("max-connections-per-ip must not be negative, got %d", c.MaxConnsPerIP))
+	}
+	if c.ConnsPerMinute < 0 {
+		errs = append(errs, fmt.Errorf("connections-per-minute must not be negative, got %d", c.ConnsPerMinute))
+	}
+	if c.MaxSpectators < 0 {
+		errs = append(errs, fmt.Errorf("max-spectators must not be negative, got %d", c.MaxSpectators))
+	}
+	if c.SpectatorDelaySec < 0 {
+		errs = append(errs, fmt.Errorf("spectator-delay must not be negative, got %d", c.SpectatorDelaySec))
+	}
+	if c.ReconnectGraceSec < 0 {
+		errs = append(errs, fmt.Errorf("reconnect-grace must not be negative, got %d", c.ReconnectGraceSec))
+	}
+	if c.MaxPlayers < 0 {
+		errs = append(errs, fmt.Errorf("max-players must not be negative, got %d", c.MaxPlayers))
+	}
+	if c.AFKWarningSec < 0 {
+		errs = append(errs, fmt.Errorf("afk-warning must not be negative, got %d", c.AFKWarningSec))
+	}
+	if c.AFKTimeoutSec < 0 {
+		errs = append(errs, fmt.Errorf("afk-timeout must not be negative, got %d", c.AFKTimeoutSec))
+	}
+	if c.AFKWarningSec > 0 && c.AFKTimeoutSec > 0 && c.AFKWarningSec >= c.AFKTimeoutSec {
+		errs = append(errs, fmt.Errorf("afk-warning must be shorter than afk-timeout, got %d and %d", c.AFKWarningSec, c.AFKTimeoutSec))
+	}
+	if c.AFKAction != "spectate" && c.AFKAction != "disconnect" {
+		errs = append(errs, fmt.Errorf("afk-action must be spectate or disconnect, got %q", c.AFKAction))
+	}
+	if c.NameMaxLength <= 0 {
+		errs = append(errs, fmt.Errorf("name-max-length must be positive, got %d", c.NameMaxLength))
+	}
+	if c.ChatMaxLength <= 0 {
+		errs = append(errs, fmt.Errorf("chat-max-length must be positive, got %d", c.ChatMaxLength))
+	}
+	if c.ChatRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("chat-rate-limit must not be negative, got %d", c.ChatRateLimit))
+	}
+	if c.ChatRateLimit > 0 && c.ChatRateWindowSec <= 0 {
+		errs = append(errs, fmt.Errorf("chat-rate-window must be positive, got %d", c.ChatRateWindowSec))
+	}
+	if c.ChatHistory < 0 {
+		errs = append(errs, fmt.Errorf("chat-history must not be negative, got %d", c.ChatHistory))
+	}
+	for _, pattern := range c.ChatBlockedPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("chat-blocked-patterns entry %q is not a valid regular expression: %w", pattern, err))
+		}
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("tls-cert and tls-key must be set together"))
+	}
+	if c.RedirectAddr != "" && c.TLSCert == "" {
+		errs = append(errs, errors.New("redirect-addr needs tls-cert and tls-key to be set"))
+	}
+	for _, origin := range c.AllowedOrigins {
+		_, host, _ := strings.Cut(origin, "://")
+		if host == "" {
+			host = origin
+		}
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			errs = append(errs, fmt.Errorf("allowed-origins entry %q must be *, an origin like https://example.com or a host like *.example.com", origin))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// LogValue implements slog.LogValuer so the effective config can be logged
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("addr", c.Addr),
+		slog.String("static-dir", c.StaticDir),
+		slog.String("log-level", c.LogLevel),
+		slog.String("log-format", c.LogFormat),
+		slog.Int("tick-interval", c.TickIntervalMs),
+		slog.Uint64("max-ticks", c.MaxTicks),
+		slog.Int("reset-timeout", c.ResetTimeoutSec),
+		slog.Int("min-players", c.MinPlayers),
+		slog.Int("waiting-timeout", c.WaitingTimeoutSec),
+		slog.Int("start-countdown", c.StartCountdownSec),
+		slog.Int("reset-pause", c.ResetPauseSec),
+		slog.String("idle-policy", c.IdlePolicy),
+		slog.Int("shutdown-timeout", c.ShutdownTimeoutSec),
+		slog.Int("reconnect-delay", c.ReconnectDelaySec),
+		slog.String("state-file", c.StateFile),
+		slog.String("ban-file", c.BanFile),
+		slog.String("results-file", c.ResultsFile),
+		slog.String("players-file", c.PlayersFile),
+		slog.Bool("admin-token", c.AdminToken != ""), // A secret, only whether it is set is logged
+		slog.String("announcement", c.Announcement),
+		slog.Any("allowed-origins", c.AllowedOrigins),
+		slog.Bool("dev-mode", c.DevMode),
+		slog.Any("trusted-proxies", c.TrustedProxies),
+		slog.Int("max-connections-per-ip", c.MaxConnsPerIP),
+		slog.Int("connections-per-minute", c.ConnsPerMinute),
+		slog.Bool("require-hello", c.RequireHello),
+		slog.Bool("legacy-sessions", c.LegacySessions),
+		slog.Bool("compression", c.Compression),
+		slog.Int("max-spectators", c.MaxSpectators),
+		slog.Int("spectator-delay", c.SpectatorDelaySec),
+		slog.Int("reconnect-grace", c.ReconnectGraceSec),
+		slog.Int("max-players", c.MaxPlayers),
+		slog.Int("priority-tokens", len(c.PriorityTokens)), // Secrets, only their number is logged
+		slog.Int("afk-warning", c.AFKWarningSec),
+		slog.Int("afk-timeout", c.AFKTimeoutSec),
+		slog.String("afk-action", c.AFKAction),
+		slog.Int("name-max-length", c.NameMaxLength),
+		slog.Any("reserved-names", c.ReservedNames),
+		slog.Int("chat-max-length", c.ChatMaxLength),
+		slog.Int("chat-rate-limit", c.ChatRateLimit),
+		slog.Int("chat-rate-window", c.ChatRateWindowSec),
+		slog.Int("chat-history", c.ChatHistory),
+		slog.Any("chat-blocked-words", c.ChatBlockedWords),
+		slog.Any("chat-blocked-patterns", c.ChatBlockedPatterns),
+		slog.String("tls-cert", c.TLSCert),
+		slog.String("tls-key", c.TLSKey),
+		slog.String("redirect-addr", c.RedirectAddr),
+		slog.String("preset", c.Preset),
+	)
+}
+
+// decode reads a YAML or JSON config file over the given config, leaving
+// settings the file doesn't mention untouched
+func decode(path string, data []byte, c *Config) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(c); err != nil {
+			return fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseInt parses a signed integer setting
+func parseInt(value string, dest *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*dest = n
+	return nil
+}
+
+// parseBool parses a boolean setting
+func parseBool(value string, dest *bool) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*dest = b
+	return nil
+}
+
+// parseList parses a comma-separated list setting, dropping empty entries
+func parseList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseUint parses an unsigned integer setting
+func parseUint(value string, dest *uint64) error {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	*dest = n
+	return nil
+}
+
+// ptr returns a pointer to a copy of the value, for building presets
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string // YAML config file, none if empty
+		env       map[string]string
+		overrides map[string]string
+		wantTick  int
+		wantMax   uint64
+		wantReset int
+		wantAddr  string
+	}{
+		{
+			name:      "defaults",
+			wantTick:  50,
+			wantMax:   100000,
+			wantReset: 30,
+			wantAddr:  ":8080",
+		},
+		{
+			name:      "preset over defaults",
+			overrides: map[string]string{"preset": "slow"},
+			wantTick:  100,
+			wantMax:   8000,
+			wantReset: 30,
+			wantAddr:  ":8080",
+		},
+		{
+			name:      "file over preset",
+			file:      "preset: slow\ntick-interval: 75\naddr: \":9000\"\n",
+			wantTick:  75,
+			wantMax:   8000,
+			wantReset: 30,
+			wantAddr:  ":9000",
+		},
+		{
+			name:      "preset defined in the file",
+			file:      "preset: custom\npresets:\n  custom:\n    reset-timeout: 12\n",
+			wantTick:  50,
+			wantMax:   100000,
+			wantReset: 12,
+			wantAddr:  ":8080",
+		},
+		{
+			name:      "environment over file",
+			file:      "tick-interval: 75\naddr: \":9000\"\n",
+			env:       map[string]string{"BLOBBERMAN_TICK_INTERVAL": "60"},
+			wantTick:  60,
+			wantMax:   100000,
+			wantReset: 30,
+			wantAddr:  ":9000",
+		},
+		{
+			name:      "environment selects the preset",
+			file:      "preset: slow\n",
+			env:       map[string]string{"BLOBBERMAN_PRESET": "quick"},
+			wantTick:  50,
+			wantMax:   2000,
+			wantReset: 5,
+			wantAddr:  ":8080",
+		},
+		{
+			name:      "flags over environment",
+			file:      "tick-interval: 75\n",
+			env:       map[string]string{"BLOBBERMAN_TICK_INTERVAL": "60", "BLOBBERMAN_ADDR": ":7000"},
+			overrides: map[string]string{"tick-interval": "40"},
+			wantTick:  40,
+			wantMax:   100000,
+			wantReset: 30,
+			wantAddr:  ":7000",
+		},
+		{
+			name:      "flag preset over environment preset",
+			env:       map[string]string{"BLOBBERMAN_PRESET": "quick"},
+			overrides: map[string]string{"preset": "slow", "max-ticks": "300"},
+			wantTick:  100,
+			wantMax:   300,
+			wantReset: 30,
+			wantAddr:  ":8080",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c, err := Load(path, tt.overrides)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if c.TickIntervalMs != tt.wantTick {
+				t.Errorf("tick-interval = %d, want %d", c.TickIntervalMs, tt.wantTick)
+			}
+			if c.MaxTicks != tt.wantMax {
+				t.Errorf("max-ticks = %d, want %d", c.MaxTicks, tt.wantMax)
+			}
+			if c.ResetTimeoutSec != tt.wantReset {
+				t.Errorf("reset-timeout = %d, want %d", c.ResetTimeoutSec, tt.wantReset)
+			}
+			if c.Addr != tt.wantAddr {
+				t.Errorf("addr = %q, want %q", c.Addr, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		overrides map[string]string
+	}{
+		{name: "unknown preset", overrides: map[string]string{"preset": "missing"}},
+		{name: "unknown file key", file: "tick-speed: 10\n"},
+		{name: "invalid flag value", overrides: map[string]string{"tick-interval": "fast"}},
+		{name: "unknown flag", overrides: map[string]string{"tick-speed": "10"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := Load(path, tt.overrides); err == nil {
+				t.Error("Load succeeded, want an error")
+			}
+		})
+	}
+}
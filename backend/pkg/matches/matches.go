@@ -0,0 +1,140 @@
+// Package matches implements the results history, a local file with one
+// finished match per line that new results are appended to.
+package matches
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// Store holds the results of finished matches, appending every new one to
+// its file
+type Store struct {
+	mutex   sync.Mutex
+	path    string // Empty to keep the results in memory only
+	matches []types.MatchResult
+	byID    map[string]int // Index of each match in matches
+}
+
+// Open loads the results history from a file, starting an empty one if the
+// file doesn't exist yet. With an empty path the results are only kept in
+// memory.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, byID: make(map[string]int)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading results file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var match types.MatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &match); err != nil {
+			return nil, fmt.Errorf("error parsing results file on line %d: %w", line, err)
+		}
+		s.byID[match.ID] = len(s.matches)
+		s.matches = append(s.matches, match)
+	}
+	return s, nil
+}
+
+// Add appends the result of a finished match to the history, returning it
+// with its ID filled in
+func (s *Store) Add(match types.MatchResult) (types.MatchResult, error) {
+	match.ID = newID()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.append(match); err != nil {
+		return types.MatchResult{}, err
+	}
+	s.byID[match.ID] = len(s.matches)
+	s.matches = append(s.matches, match)
+	return match, nil
+}
+
+// List returns up to limit results, newest first, skipping the offset
+// newest ones
+func (s *Store) List(offset int, limit int) []types.MatchResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	matches := make([]types.MatchResult, 0, min(limit, max(len(s.matches)-offset, 0)))
+	for i := len(s.matches) - 1 - offset; i >= 0 && len(matches) < limit; i-- {
+		matches = append(matches, s.matches[i])
+	}
+	return matches
+}
+
+// Get returns the result of a match by its ID
+func (s *Store) Get(id string) (types.MatchResult, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i, ok := s.byID[id]
+	if !ok {
+		return types.MatchResult{}, false
+	}
+	return s.matches[i], true
+}
+
+// Len returns the number of matches in the history
+func (s *Store) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.matches)
+}
+
+// append writes a match as a new line at the end of the file, the mutex must
+// be held
+func (s *Store) append(match types.MatchResult) error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(match)
+	if err != nil {
+		return fmt.Errorf("error marshalling match result: %w", err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening results file: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing results file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing results file: %w", err)
+	}
+	return nil
+}
+
+// newID creates a random match ID
+func newID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,65 @@
+// Package names normalizes and validates player display names.
+package names
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Reasons a display name is refused
+var (
+	ErrEmpty     = errors.New("name is empty")
+	ErrTooLong   = errors.New("name is too long")
+	ErrInvisible = errors.New("name contains control or invisible characters")
+	ErrTaken     = errors.New("name is already taken")
+	ErrReserved  = errors.New("name is reserved")
+)
+
+// folder folds case for comparing names, so that names differing only in
+// case are treated as the same
+var folder = cases.Fold()
+
+// blank holds runes that are letters or symbols but render as nothing or as
+// blank space, which would let a name look empty or like another name
+var blank = []*unicode.RangeTable{
+	unicode.Other_Default_Ignorable_Code_Point,                    // Hangul fillers among others
+	{R16: []unicode.Range16{{Lo: 0x2800, Hi: 0x2800, Stride: 1}}}, // Braille pattern blank
+}
+
+// visible reports whether a rune may appear in a name: letters, marks,
+// numbers, punctuation and symbols that don't render blank
+func visible(r rune) bool {
+	return unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P, unicode.S) && !unicode.In(r, blank...)
+}
+
+// Normalize trims a display name, converts it to Unicode NFC and collapses
+// runs of whitespace into a single space, refusing names that are empty,
+// longer than maxLength characters or contain control or invisible
+// characters. A maxLength of zero or less doesn't limit the length.
+func Normalize(name string, maxLength int) (string, error) {
+	name = strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+	if name == "" {
+		return "", ErrEmpty
+	}
+	if maxLength > 0 && utf8.RuneCountInString(name) > maxLength {
+		return "", ErrTooLong
+	}
+
+	for _, r := range name {
+		if r != ' ' && !visible(r) {
+			return "", ErrInvisible
+		}
+	}
+
+	return name, nil
+}
+
+// Key returns the form of a normalized name used to compare it with others
+func Key(name string) string {
+	return norm.NFC.String(folder.String(name))
+}
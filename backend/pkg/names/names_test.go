@@ -0,0 +1,71 @@
+package names
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxLength int
+		want      string
+		wantErr   error
+	}{
+		{name: "unchanged", input: "Blobber", maxLength: 24, want: "Blobber"},
+		{name: "trimmed", input: "  Blobber \t", maxLength: 24, want: "Blobber"},
+		{name: "whitespace collapsed", input: "Big \t\n Blob", maxLength: 24, want: "Big Blob"},
+		{name: "composed to NFC", input: "José", maxLength: 24, want: "José"},
+		{name: "empty", input: "", maxLength: 24, wantErr: ErrEmpty},
+		{name: "only whitespace", input: " \t\n", maxLength: 24, wantErr: ErrEmpty},
+		{name: "length counts characters", input: "ééééé", maxLength: 5, want: "ééééé"},
+		{name: "too long", input: "abcdef", maxLength: 5, wantErr: ErrTooLong},
+		{name: "length checked after trimming", input: "  abcde  ", maxLength: 5, want: "abcde"},
+		{name: "no length limit", input: "a very long name indeed, longer than most", maxLength: 0, want: "a very long name indeed, longer than most"},
+		{name: "zero width space", input: "Blob\u200bber", maxLength: 24, wantErr: ErrInvisible},
+		{name: "control character", input: "Blob\x07ber", maxLength: 24, wantErr: ErrInvisible},
+		{name: "bidi override", input: "\u202eBlobber", maxLength: 24, wantErr: ErrInvisible},
+		{name: "hangul filler", input: "\u3164", maxLength: 24, wantErr: ErrInvisible},
+		{name: "hangul filler inside", input: "Blob\u3164ber", maxLength: 24, wantErr: ErrInvisible},
+		{name: "halfwidth hangul filler", input: "Blob\uffa0ber", maxLength: 24, wantErr: ErrInvisible},
+		{name: "braille blank", input: "\u2800", maxLength: 24, wantErr: ErrInvisible},
+		{name: "braille blank inside", input: "Admin\u2800", maxLength: 24, wantErr: ErrInvisible},
+		{name: "combining grapheme joiner", input: "Blob\u034fber", maxLength: 24, wantErr: ErrInvisible},
+		{name: "ideographic space collapsed", input: "Big\u3000Blob", maxLength: 24, want: "Big Blob"},
+		{name: "hangul", input: "한글", maxLength: 24, want: "한글"},
+		{name: "braille pattern", input: "⠁⠃", maxLength: 24, want: "⠁⠃"},
+		{name: "emoji", input: "Blob ❤\ufe0f", maxLength: 24, want: "Blob ❤\ufe0f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input, tt.maxLength)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Normalize(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{a: "Blobber", b: "blobber", same: true},
+		{a: "BLOBBER", b: "blobber", same: true},
+		{a: "Straße", b: "STRASSE", same: true},
+		{a: "José", b: "josé", same: true},
+		{a: "Blobber", b: "Blobber2", same: false},
+	}
+
+	for _, tt := range tests {
+		if same := Key(tt.a) == Key(tt.b); same != tt.same {
+			t.Errorf("Key(%q) == Key(%q) is %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package profiles implements the player store, the lifetime statistics and
+// skill rating of every player by their persistent player ID, kept in a
+// local file and updated with the result of each match.
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/atomicfile"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/rating"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// Most rating changes kept for each player
+const maxRatingHistory = 200
+
+// ErrUnknownSort is returned for a leaderboard sorted by an unknown statistic
+var ErrUnknownSort = errors.New("unknown leaderboard sort")
+
+// Profile holds a player's lifetime statistics
+type Profile struct {
+	PlayerID      string    `json:"playerId"`
+	DisplayName   string    `json:"displayName,omitempty"` // Display name the player last played under
+	MatchesPlayed int       `json:"matchesPlayed"`
+	Wins          int       `json:"wins"`
+	TilesPainted  int       `json:"tilesPainted"` // Tiles painted at the end of each match
+	BombsDropped  int       `json:"bombsDropped"`
+	HitsTaken     int       `json:"hitsTaken"`
+	Rating        float64   `json:"rating"` // Skill rating, see package rating
+	FirstPlayedAt time.Time `json:"firstPlayedAt"`
+	LastPlayedAt  time.Time `json:"lastPlayedAt"`
+}
+
+// RatingChange is the change of a player's rating after a match
+type RatingChange struct {
+	MatchID  string    `json:"matchId"`
+	PlayedAt time.Time `json:"playedAt"`
+	Rank     int       `json:"rank"`    // Placement in the match
+	Players  int       `json:"players"` // Players ranked in the match
+	Rating   float64   `json:"rating"`  // Rating after the match
+	Change   float64   `json:"change"`
+}
+
+// Sorts the leaderboard can be ordered by, highest first
+var sorts = map[string]func(a, b *Profile) bool{
+	"rating":  func(a, b *Profile) bool { return a.Rating > b.Rating },
+	"wins":    func(a, b *Profile) bool { return a.Wins > b.Wins },
+	"matches": func(a, b *Profile) bool { return a.MatchesPlayed > b.MatchesPlayed },
+	"tiles":   func(a, b *Profile) bool { return a.TilesPainted > b.TilesPainted },
+	"bombs":   func(a, b *Profile) bool { return a.BombsDropped > b.BombsDropped },
+	"hits":    func(a, b *Profile) bool { return a.HitsTaken > b.HitsTaken },
+	"recent":  func(a, b *Profile) bool { return a.LastPlayedAt.After(b.LastPlayedAt) },
+}
+
+// DefaultSort is the statistic the leaderboard is ordered by when none is given
+const DefaultSort = "rating"
+
+// file is the format of the player file
+type file struct {
+	Players       []*Profile                `json:"players"`
+	RatingHistory map[string][]RatingChange `json:"ratingHistory,omitempty"`
+}
+
+// Store holds the profile of every player who finished a match, saving
+// every change to its file
+type Store struct {
+	mutex    sync.Mutex
+	path     string // Empty to keep the profiles in memory only
+	profiles map[string]*Profile
+	history  map[string][]RatingChange // Rating changes of each player, oldest first
+}
+
+// Open loads the player store from a file, starting an empty one if the file
+// doesn't exist yet. With an empty path the profiles are only kept in memory.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, profiles: make(map[string]*Profile), history: make(map[string][]RatingChange)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading player file: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing player file: %w", err)
+	}
+	for _, profile := range f.Players {
+		if profile != nil && profile.PlayerID != "" {
+			// Profiles saved before ratings were kept start from scratch
+			if profile.Rating == 0 {
+				profile.Rating = rating.Initial
+			}
+			s.profiles[profile.PlayerID] = profile
+		}
+	}
+	for playerID, history := range f.RatingHistory {
+		s.history[playerID] = history
+	}
+	return s, nil
+}
+
+// Record adds the result of a finished match to the profiles of the players
+// ranked in it, rates them by their placements and saves them
+func (s *Store) Record(result types.MatchResult) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := make(map[string]*Profile, len(result.Rankings))
+	previousHistory := make(map[string][]RatingChange, len(result.Rankings))
+	ratings := make([]float64, len(result.Rankings))
+	placements := make([]int, len(result.Rankings))
+	for i, ranking := range result.Rankings {
+		profile, ok := s.profiles[ranking.PlayerID]
+		if ok {
+			saved := *profile
+			previous[ranking.PlayerID] = &saved
+		} else {
+			profile = &Profile{PlayerID: ranking.PlayerID, Rating: rating.Initial, FirstPlayedAt: result.EndedAt}
+			s.profiles[ranking.PlayerID] = profile
+			previous[ranking.PlayerID] = nil
+		}
+		previousHistory[ranking.PlayerID] = s.history[ranking.PlayerID]
+		ratings[i] = profile.Rating
+		placements[i] = ranking.Rank
+
+		if ranking.DisplayName != "" {
+			profile.DisplayName = ranking.DisplayName
+		}
+		profile.MatchesPlayed++
+		if ranking.PlayerID == result.Winner {
+			profile.Wins++
+		}
+		profile.TilesPainted += ranking.Score
+		profile.BombsDropped += ranking.BombsDropped
+		profile.HitsTaken += ranking.HitsTaken
+		profile.LastPlayedAt = result.EndedAt
+	}
+
+	for i, updated := range rating.Update(ratings, placements) {
+		ranking := result.Rankings[i]
+		profile := s.profiles[ranking.PlayerID]
+		profile.Rating = math.Round(updated*10) / 10
+
+		history := append(s.history[ranking.PlayerID], RatingChange{
+			MatchID:  result.ID,
+			PlayedAt: result.EndedAt,
+			Rank:     ranking.Rank,
+			Players:  len(result.Rankings),
+			Rating:   profile.Rating,
+			Change:   math.Round((profile.Rating-ratings[i])*10) / 10,
+		})
+		s.history[ranking.PlayerID] = history[max(len(history)-maxRatingHistory, 0):]
+	}
+
+	if err := s.save(); err != nil {
+		// Keep the profiles in line with the file
+		for playerID, profile := range previous {
+			if profile == nil {
+				delete(s.profiles, playerID)
+			} else {
+				s.profiles[playerID] = profile
+			}
+		}
+		for playerID, history := range previousHistory {
+			if history == nil {
+				delete(s.history, playerID)
+			} else {
+				s.history[playerID] = history
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns a player's profile
+func (s *Store) Get(playerID string) (Profile, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	profile, ok := s.profiles[playerID]
+	if !ok {
+		return Profile{}, false
+	}
+	return *profile, true
+}
+
+// Rating returns a player's rating, the initial rating for players who
+// haven't finished a match
+func (s *Store) Rating(playerID string) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if profile, ok := s.profiles[playerID]; ok {
+		return profile.Rating
+	}
+	return rating.Initial
+}
+
+// RatingHistory returns up to limit of a player's rating changes, newest
+// first, skipping the offset newest ones
+func (s *Store) RatingHistory(playerID string, offset int, limit int) []RatingChange {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	history := s.history[playerID]
+	changes := make([]RatingChange, 0, min(limit, max(len(history)-offset, 0)))
+	for i := len(history) - 1 - offset; i >= 0 && len(changes) < limit; i-- {
+		changes = append(changes, history[i])
+	}
+	return changes
+}
+
+// Leaderboard returns up to limit profiles ordered by a statistic, highest
+// first, skipping the offset best ones
+func (s *Store) Leaderboard(sortBy string, offset int, limit int) ([]Profile, error) {
+	less, ok := sorts[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSort, sortBy)
+	}
+
+	s.mutex.Lock()
+	ordered := make([]*Profile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		ordered = append(ordered, profile)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if less(ordered[i], ordered[j]) {
+			return true
+		}
+		if less(ordered[j], ordered[i]) {
+			return false
+		}
+		return ordered[i].PlayerID < ordered[j].PlayerID
+	})
+
+	profiles := make([]Profile, 0, min(limit, max(len(ordered)-offset, 0)))
+	for i := offset; i < len(ordered) && len(profiles) < limit; i++ {
+		profiles = append(profiles, *ordered[i])
+	}
+	s.mutex.Unlock()
+
+	return profiles, nil
+}
+
+// Len returns the number of players in the store
+func (s *Store) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.profiles)
+}
+
+// save writes the profiles to the player file, replacing it atomically, the
+// mutex must be held
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	f := file{Players: make([]*Profile, 0, len(s.profiles)), RatingHistory: s.history}
+	for _, profile := range s.profiles {
+		f.Players = append(f.Players, profile)
+	}
+	sort.Slice(f.Players, func(i, j int) bool { return f.Players[i].PlayerID < f.Players[j].PlayerID })
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling profiles: %w", err)
+	}
+
+	if err := atomicfile.Write(s.path, data); err != nil {
+		return fmt.Errorf("error saving player file: %w", err)
+	}
+	return nil
+}
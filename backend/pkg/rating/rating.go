@@ -0,0 +1,58 @@
+// Package rating implements a multiplayer Elo rating for free-for-all
+// matches, treating a match as a game between every pair of players in it.
+package rating
+
+import "math"
+
+// Initial is the rating of a player who hasn't finished a match yet
+const Initial = 1500.0
+
+// K is the most a player's rating can move in one match, split between
+// their opponents so large matches don't swing ratings more than small ones
+const K = 32.0
+
+// Update returns the new ratings of the players in a match from their
+// ratings before it and their final placements, a lower placement being
+// better and equal placements a draw
+//
+// Every player is compared with every other: beating an opponent counts as
+// a win, placing below them as a loss, each weighed against the chance of
+// winning the Elo ratings predict. A player alone in a match keeps their
+// rating.
+func Update(ratings []float64, placements []int) []float64 {
+	updated := make([]float64, len(ratings))
+	copy(updated, ratings)
+	if len(ratings) < 2 {
+		return updated
+	}
+
+	k := K / float64(len(ratings)-1)
+	for i := range ratings {
+		change := 0.0
+		for j := range ratings {
+			if i == j {
+				continue
+			}
+			change += score(placements[i], placements[j]) - expected(ratings[i], ratings[j])
+		}
+		updated[i] += k * change
+	}
+	return updated
+}
+
+// expected is the chance a player rated a beats a player rated b
+func expected(a float64, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// score is the outcome for a player placed a against one placed b
+func score(a int, b int) float64 {
+	switch {
+	case a < b:
+		return 1
+	case a > b:
+		return 0
+	default:
+		return 0.5
+	}
+}
@@ -0,0 +1,93 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		ratings    []float64
+		placements []int
+		want       []float64
+	}{
+		{
+			name:       "alone",
+			ratings:    []float64{1500},
+			placements: []int{1},
+			want:       []float64{1500},
+		},
+		{
+			name:       "equal players, one wins",
+			ratings:    []float64{1500, 1500},
+			placements: []int{1, 2},
+			want:       []float64{1516, 1484},
+		},
+		{
+			name:       "equal players tie",
+			ratings:    []float64{1500, 1500},
+			placements: []int{1, 1},
+			want:       []float64{1500, 1500},
+		},
+		{
+			name:       "tie with a stronger player",
+			ratings:    []float64{1600, 1400},
+			placements: []int{1, 1},
+			want:       []float64{1591.6881, 1408.3119},
+		},
+		{
+			name:       "underdog wins",
+			ratings:    []float64{1400, 1600},
+			placements: []int{1, 2},
+			want:       []float64{1424.3119, 1575.6881},
+		},
+		{
+			name:       "two tied for first",
+			ratings:    []float64{1500, 1500, 1500},
+			placements: []int{1, 1, 3},
+			want:       []float64{1508, 1508, 1484},
+		},
+		{
+			name:       "all tied",
+			ratings:    []float64{1500, 1500, 1500, 1500},
+			placements: []int{2, 2, 2, 2},
+			want:       []float64{1500, 1500, 1500, 1500},
+		},
+		{
+			name:       "four players in order",
+			ratings:    []float64{1500, 1500, 1500, 1500},
+			placements: []int{1, 2, 3, 4},
+			want:       []float64{1516, 1505.3333, 1494.6667, 1484},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Update(tt.ratings, tt.placements)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d ratings, want %d", len(got), len(tt.want))
+			}
+
+			before, after := 0.0, 0.0
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 0.001 {
+					t.Errorf("rating %d = %.4f, want %.4f", i, got[i], tt.want[i])
+				}
+				before += tt.ratings[i]
+				after += got[i]
+			}
+			if math.Abs(before-after) > 0.001 {
+				t.Errorf("ratings sum to %.4f after the match, %.4f before", after, before)
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsInput(t *testing.T) {
+	ratings := []float64{1500, 1500}
+	Update(ratings, []int{1, 2})
+	if ratings[0] != 1500 || ratings[1] != 1500 {
+		t.Errorf("Update changed its input to %v", ratings)
+	}
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 // Direction represents a movement direction
 type Direction string
 
@@ -24,19 +26,97 @@ type PlayerInput struct {
 type GameTick struct {
 	Tick   uint64        `json:"tick"`
 	Inputs []PlayerInput `json:"inputs"`
+	Events []GameEvent   `json:"events,omitempty"` // Server events that happened before this tick, in order
+}
+
+// EventKind identifies a server event recorded in the tick stream
+type EventKind string
+
+const (
+	EventJoin       EventKind = "join"       // A player came online, Value is their display name
+	EventLeave      EventKind = "leave"      // A player went offline
+	EventNameChange EventKind = "nameChange" // A player changed display name, Value is the new name
+	EventAdmin      EventKind = "admin"      // An operator changed the server, Value describes the action
+	EventSeed       EventKind = "seed"       // The random seed of the game session, Value is the seed in decimal
+	EventChat       EventKind = "chat"       // A player posted a chat message, Value is the text
+)
+
+// GameEvent is a server event recorded in the tick stream, so every client
+// and replay sees it at the same tick
+type GameEvent struct {
+	Kind     EventKind `json:"kind"`
+	PlayerID string    `json:"playerId,omitempty"`
+	Value    string    `json:"value,omitempty"`
 }
 
 // MessageType defines the type of message being sent
 type MessageType string
 
 const (
-	MessageTypeConnect     MessageType = "connect"
-	MessageTypeInput       MessageType = "input"
-	MessageTypeTick        MessageType = "tick"
-	MessageTypeHistorySync MessageType = "historySync"
-	MessageTypeReset       MessageType = "reset"
-	MessageTypeDisplayName MessageType = "displayName"
-	MessageTypeClientId    MessageType = "clientId"
+	MessageTypeConnect       MessageType = "connect"
+	MessageTypeInput         MessageType = "input"
+	MessageTypeTick          MessageType = "tick"
+	MessageTypeHistorySync   MessageType = "historySync"
+	MessageTypeReset         MessageType = "reset"
+	MessageTypeDisplayName   MessageType = "displayName"
+	MessageTypeClientId      MessageType = "clientId"
+	MessageTypeShutdown      MessageType = "serverShutdown"
+	MessageTypeAnnounce      MessageType = "announcement"
+	MessageTypeHello         MessageType = "hello"
+	MessageTypeUnsupported   MessageType = "unsupportedVersion"
+	MessageTypePlayerTable   MessageType = "playerTable"
+	MessageTypeError         MessageType = "error"
+	MessageTypeChat          MessageType = "chat"
+	MessageTypeChatHistory   MessageType = "chatHistory"
+	MessageTypeJoined        MessageType = "playerJoined"
+	MessageTypeLeft          MessageType = "playerLeft"
+	MessageTypeReconnected   MessageType = "playerReconnected"
+	MessageTypeReconnecting  MessageType = "playerReconnecting"
+	MessageTypeRoster        MessageType = "roster"
+	MessageTypeAFKWarning    MessageType = "afkWarning"
+	MessageTypeAFKKick       MessageType = "afkKick"
+	MessageTypeQueuePosition MessageType = "queuePosition"
+	MessageTypePhase         MessageType = "phase"
+	MessageTypeMatchResult   MessageType = "matchResult"
+	MessageTypeMatchResults  MessageType = "matchResults"
+)
+
+// MatchPhase is the stage of its lifecycle a match is in
+type MatchPhase string
+
+const (
+	PhaseWaiting   MatchPhase = "waiting"   // Waiting for enough players to join
+	PhaseStarting  MatchPhase = "starting"  // Counting down to the start of the match
+	PhasePlaying   MatchPhase = "playing"   // The match is running
+	PhaseResults   MatchPhase = "results"   // The match is over and its results are shown
+	PhaseResetting MatchPhase = "resetting" // The match has been cleared for the next one
+)
+
+// Role is the part a connection plays in a match
+type Role string
+
+const (
+	RolePlayer    Role = "player"    // Takes part in the match
+	RoleSpectator Role = "spectator" // Watches the match without taking part
+)
+
+// Error codes sent in error messages
+const (
+	ErrorCodeSpectatorInput = "spectatorInput" // Spectators can't send input or pick a name
+	ErrorCodeSpectatorsFull = "spectatorsFull" // No more spectators are allowed
+	ErrorCodeSessionInvalid = "sessionInvalid" // Player ID is taken by a session the client can't prove it owns
+	ErrorCodeNameEmpty      = "nameEmpty"      // Display name has no visible characters
+	ErrorCodeNameTooLong    = "nameTooLong"    // Display name is longer than allowed
+	ErrorCodeNameInvalid    = "nameInvalid"    // Display name contains control or invisible characters
+	ErrorCodeNameTaken      = "nameTaken"      // Another player in the room already uses the display name
+	ErrorCodeNameReserved   = "nameReserved"   // Display name is reserved by the server
+	ErrorCodeChatEmpty      = "chatEmpty"      // Chat message has no text
+	ErrorCodeChatTooLong    = "chatTooLong"    // Chat message is longer than allowed
+	ErrorCodeChatRateLimit  = "chatRateLimit"  // Player is sending chat messages too quickly
+	ErrorCodeChatBlocked    = "chatBlocked"    // Chat message was blocked by a moderation filter
+	ErrorCodeBanned         = "banned"         // Player ID or IP is banned from the server
+	ErrorCodeQueued         = "queued"         // Player waits in the join queue and can't take part yet
+	ErrorCodeNotJoined      = "notJoined"      // Client hasn't sent its player ID yet
 )
 
 // ConnectMessage is sent when a player connects to the game
@@ -45,6 +125,10 @@ type ConnectMessage struct {
 	PlayerID     string      `json:"playerId"`
 	MaxTicks     uint64      `json:"maxTicks"`     // Maximum number of ticks in the game session
 	TickInterval int         `json:"tickInterval"` // Milliseconds between ticks
+	Spectator    bool        `json:"spectator,omitempty"`
+	DelaySec     int         `json:"delaySec,omitempty"`     // Delay of the delayed spectator feed
+	SessionToken string      `json:"sessionToken,omitempty"` // Token to resume the player's session after reconnecting
+	Rating       int         `json:"rating,omitempty"`       // Skill rating of the player, not sent to spectators
 }
 
 // GetType returns the message type
@@ -124,11 +208,252 @@ func (m DisplayNameUpdateMessage) GetType() MessageType {
 
 // ClientIdMessage is sent by the client to provide its persistent player ID
 type ClientIdMessage struct {
+	Type          MessageType `json:"type"`
+	PlayerID      string      `json:"playerId"`
+	SessionToken  string      `json:"sessionToken,omitempty"`  // Token from the connect message, to resume a session
+	PriorityToken string      `json:"priorityToken,omitempty"` // Token letting the player skip ahead of the join queue
+}
+
+// GetType returns the message type
+func (m ClientIdMessage) GetType() MessageType {
+	return m.Type
+}
+
+// ServerShutdownMessage is sent to all clients when the server is shutting down
+type ServerShutdownMessage struct {
+	Type              MessageType `json:"type"`
+	Reason            string      `json:"reason"`
+	ReconnectAfterSec int         `json:"reconnectAfterSec"` // Suggested delay before reconnecting
+}
+
+// GetType returns the message type
+func (m ServerShutdownMessage) GetType() MessageType {
+	return m.Type
+}
+
+// AnnouncementMessage carries the server's announcement text, an empty text clears it
+type AnnouncementMessage struct {
+	Type MessageType `json:"type"`
+	Text string      `json:"text"`
+}
+
+// GetType returns the message type
+func (m AnnouncementMessage) GetType() MessageType {
+	return m.Type
+}
+
+// HelloMessage is sent by the client to state the protocol version and
+// capabilities it supports, the server replies with the negotiated version
+// and the capabilities both sides support
+type HelloMessage struct {
+	Type            MessageType `json:"type"`
+	ProtocolVersion int         `json:"protocolVersion"`
+	Capabilities    []string    `json:"capabilities"`
+	Role            Role        `json:"role,omitempty"` // Role the client asks for, or was given
+}
+
+// GetType returns the message type
+func (m HelloMessage) GetType() MessageType {
+	return m.Type
+}
+
+// UnsupportedVersionMessage is sent before the server closes a connection
+// speaking a protocol version it doesn't support
+type UnsupportedVersionMessage struct {
+	Type               MessageType `json:"type"`
+	ProtocolVersion    int         `json:"protocolVersion"`    // Version the client asked for
+	MinProtocolVersion int         `json:"minProtocolVersion"` // Oldest version the server accepts
+	MaxProtocolVersion int         `json:"maxProtocolVersion"` // Newest version the server speaks
+	Reason             string      `json:"reason"`
+}
+
+// GetType returns the message type
+func (m UnsupportedVersionMessage) GetType() MessageType {
+	return m.Type
+}
+
+// PlayerTableMessage lists the players of the running match in the order of
+// their index in binary encoded ticks
+type PlayerTableMessage struct {
+	Type    MessageType `json:"type"`
+	Players []string    `json:"players"`
+}
+
+// GetType returns the message type
+func (m PlayerTableMessage) GetType() MessageType {
+	return m.Type
+}
+
+// ErrorMessage tells a client that a message it sent was refused
+type ErrorMessage struct {
+	Type    MessageType `json:"type"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+}
+
+// GetType returns the message type
+func (m ErrorMessage) GetType() MessageType {
+	return m.Type
+}
+
+// ChatMessage is sent by a player to chat, and broadcast by the server with
+// the sender and time filled in
+type ChatMessage struct {
 	Type     MessageType `json:"type"`
 	PlayerID string      `json:"playerId"`
+	Text     string      `json:"text"`
+	Tick     uint64      `json:"tick"`   // Tick of the match the message was sent on
+	SentAt   int64       `json:"sentAt"` // Unix time in milliseconds
 }
 
 // GetType returns the message type
-func (m ClientIdMessage) GetType() MessageType {
+func (m ChatMessage) GetType() MessageType {
+	return m.Type
+}
+
+// ChatHistoryMessage is sent to new clients with the most recent chat messages
+type ChatHistoryMessage struct {
+	Type     MessageType   `json:"type"`
+	Messages []ChatMessage `json:"messages"`
+}
+
+// GetType returns the message type
+func (m ChatHistoryMessage) GetType() MessageType {
+	return m.Type
+}
+
+// PresenceMessage is broadcast when a player joins, leaves or reconnects to
+// the match, with the type telling which
+type PresenceMessage struct {
+	Type        MessageType `json:"type"`
+	PlayerID    string      `json:"playerId"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Timestamp   int64       `json:"timestamp"` // Unix time in milliseconds
+}
+
+// GetType returns the message type
+func (m PresenceMessage) GetType() MessageType {
+	return m.Type
+}
+
+// RosterEntry describes a player who is online
+type RosterEntry struct {
+	PlayerID     string `json:"playerId"`
+	DisplayName  string `json:"displayName,omitempty"`
+	JoinedAt     int64  `json:"joinedAt"`               // Unix time in milliseconds of the player's latest join
+	Reconnecting bool   `json:"reconnecting,omitempty"` // Disconnected, but within the reconnect grace period
+	Rating       int    `json:"rating"`                 // Skill rating of the player
+}
+
+// RosterMessage is sent to new clients with the players who are online
+type RosterMessage struct {
+	Type    MessageType   `json:"type"`
+	Players []RosterEntry `json:"players"`
+}
+
+// GetType returns the message type
+func (m RosterMessage) GetType() MessageType {
+	return m.Type
+}
+
+// AFKMessage warns a player who hasn't moved for a while, or tells them they
+// were moved to the spectators or disconnected for it, with the type telling
+// which
+type AFKMessage struct {
+	Type        MessageType `json:"type"`
+	IdleSec     int         `json:"idleSec"`               // Seconds since the player last moved
+	Action      string      `json:"action"`                // spectate or disconnect
+	ActionInSec int         `json:"actionInSec,omitempty"` // Seconds until the action is taken, on warnings
+}
+
+// GetType returns the message type
+func (m AFKMessage) GetType() MessageType {
+	return m.Type
+}
+
+// QueuePositionMessage tells a player waiting for a slot in a full room
+// their place in the join queue, it is sent when they are queued and
+// whenever their place changes
+type QueuePositionMessage struct {
+	Type        MessageType `json:"type"`
+	Position    int         `json:"position"`    // Place in the queue, counting from one
+	QueueLength int         `json:"queueLength"` // Number of players waiting
+}
+
+// GetType returns the message type
+func (m QueuePositionMessage) GetType() MessageType {
+	return m.Type
+}
+
+// PhaseMessage tells clients the match moved to another phase, it is sent
+// on every transition and to clients when they connect
+type PhaseMessage struct {
+	Type        MessageType `json:"type"`
+	Phase       MatchPhase  `json:"phase"`
+	DurationSec int         `json:"durationSec"`      // Seconds the phase lasts, zero until players join or leave
+	EndsAt      int64       `json:"endsAt,omitempty"` // When the phase ends, in Unix milliseconds
+	MinPlayers  int         `json:"minPlayers"`       // Players needed to start a match
+}
+
+// GetType returns the message type
+func (m PhaseMessage) GetType() MessageType {
+	return m.Type
+}
+
+// PlayerScore is a player's final score in a match
+type PlayerScore struct {
+	PlayerID     string `json:"playerId"`
+	Score        int    `json:"score"` // Tiles painted by the player
+	BombsDropped int    `json:"bombsDropped"`
+	HitsTaken    int    `json:"hitsTaken"` // Times the player was caught in an explosion
+}
+
+// MatchResultMessage is sent by players once their simulation reaches the
+// end of the match, reporting the final scores it computed
+type MatchResultMessage struct {
+	Type   MessageType   `json:"type"`
+	Tick   uint64        `json:"tick"` // Tick the simulation ended on
+	Scores []PlayerScore `json:"scores"`
+}
+
+// GetType returns the message type
+func (m MatchResultMessage) GetType() MessageType {
+	return m.Type
+}
+
+// Ranking is a player's place in the final standings of a match, players
+// with the same score share a rank
+type Ranking struct {
+	Rank         int    `json:"rank"`
+	PlayerID     string `json:"playerId"`
+	DisplayName  string `json:"displayName,omitempty"`
+	Score        int    `json:"score"`
+	BombsDropped int    `json:"bombsDropped"`
+	HitsTaken    int    `json:"hitsTaken"`
+}
+
+// MatchResult is the outcome of a finished match
+type MatchResult struct {
+	ID        string    `json:"id"`
+	Room      string    `json:"room"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	Ticks     uint64    `json:"ticks"`
+	Rankings  []Ranking `json:"rankings"`
+	Winner    string    `json:"winner,omitempty"` // Player ID of the winner, empty on a tie
+	Players   int       `json:"players"`          // Players in the match when it ended
+	Reports   int       `json:"reports"`          // Players who reported a result
+	Agreed    int       `json:"agreed"`           // Players who reported the result that was recorded
+	Confirmed bool      `json:"confirmed"`        // Whether a majority of the players agreed on the result
+}
+
+// MatchResultsMessage announces the result of the match that just ended
+type MatchResultsMessage struct {
+	Type   MessageType `json:"type"`
+	Result MatchResult `json:"result"`
+}
+
+// GetType returns the message type
+func (m MatchResultsMessage) GetType() MessageType {
 	return m.Type
 }
@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/bans"
+)
+
+// banRequest is the body of a request adding a ban
+type banRequest struct {
+	PlayerID    string     `json:"playerId"`
+	IP          string     `json:"ip"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expiresAt"`   // When the ban expires
+	DurationSec int        `json:"durationSec"` // Seconds the ban lasts, instead of ExpiresAt
+}
+
+// AdminHandler serves the admin API under /api/admin/
+//
+// Every request must carry the configured admin token as a bearer token in
+// its Authorization header. Without an admin token the API is disabled and
+// answers every request with 404.
+//
+//	GET    /api/admin/bans       lists the bans in force
+//	POST   /api/admin/bans       adds a ban, disconnecting the clients it covers
+//	DELETE /api/admin/bans/{id}  lifts a ban
+func AdminHandler(hub *Hub, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/admin/bans", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hub.Bans().List())
+	})
+
+	mux.HandleFunc("POST /api/admin/bans", func(w http.ResponseWriter, r *http.Request) {
+		var request banRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request); err != nil {
+			http.Error(w, "Invalid ban: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ban := bans.Ban{PlayerID: request.PlayerID, IP: request.IP, Reason: request.Reason, ExpiresAt: request.ExpiresAt}
+		if request.DurationSec > 0 {
+			expiresAt := time.Now().Add(time.Duration(request.DurationSec) * time.Second)
+			ban.ExpiresAt = &expiresAt
+		}
+
+		ban, err := hub.AddBan(ban)
+		if err != nil {
+			status := http.StatusBadRequest
+			if !isBanError(err) {
+				status = http.StatusInternalServerError
+				logger.Error("Failed to add ban", "error", err)
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeJSON(w, http.StatusCreated, ban)
+	})
+
+	mux.HandleFunc("DELETE /api/admin/bans/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ban, err := hub.RemoveBan(r.PathValue("id"))
+		if errors.Is(err, bans.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to lift ban", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, ban)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := hub.adminToken.Load()
+		if token == nil || *token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(*token)) != 1 {
+			logger.Warn("Rejected admin request", "method", r.Method, "path", r.URL.Path,
+				"clientIP", hub.proxyPolicy.Load().ClientIP(r))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		logger.Info("Admin request", "method", r.Method, "path", r.URL.Path,
+			"clientIP", hub.proxyPolicy.Load().ClientIP(r))
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// isBanError reports whether an error is caused by an invalid ban rather
+// than failing to save it
+func isBanError(err error) bool {
+	return errors.Is(err, bans.ErrNoTarget) || errors.Is(err, bans.ErrManyTargets) ||
+		errors.Is(err, bans.ErrInvalidIP) || errors.Is(err, bans.ErrExpired)
+}
+
+// writeJSON writes a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
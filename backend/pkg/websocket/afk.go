@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+// How often players are checked for being idle
+const afkCheckInterval = time.Second
+
+// WebSocket close code sent to players disconnected for being idle
+const CloseIdle = 4001
+
+// AFKAction is what happens to a player who stays idle past the AFK timeout
+type AFKAction string
+
+const (
+	// AFKSpectate moves the idle player to the spectators
+	AFKSpectate AFKAction = "spectate"
+	// AFKDisconnect closes the idle player's connection
+	AFKDisconnect AFKAction = "disconnect"
+)
+
+// markActive records that a player sent a meaningful input on the current
+// tick, the input mutex must be held
+func (h *Hub) markActive(input types.PlayerInput) {
+	if input.Up || input.Down || input.Left || input.Right || input.PlaceBlob {
+		h.lastActive[input.PlayerID] = h.CurrentTick
+		delete(h.afkWarned, input.PlayerID)
+	}
+}
+
+// resetIdle starts a player's idle time over, when they join
+func (h *Hub) resetIdle(playerID string) {
+	h.InputMutex.Lock()
+	defer h.InputMutex.Unlock()
+
+	delete(h.lastActive, playerID)
+	delete(h.afkWarned, playerID)
+}
+
+// checkAFK warns players who haven't moved for the AFK warning time and
+// moves them to the spectators or disconnects them once they reach the AFK
+// timeout, from within Run
+//
+// Idle time is counted in ticks, so it doesn't grow while the match is
+// suspended or between game sessions.
+func (h *Hub) checkAFK() {
+	if h.afkWarningSec <= 0 && h.afkTimeoutSec <= 0 {
+		return
+	}
+
+	// Only players who have joined the match can be idle
+	h.presenceMutex.Lock()
+	players := make(map[*common.Client]string, len(h.joined))
+	for client, playerID := range h.joined {
+		if !client.Spectator.Load() {
+			players[client] = playerID
+		}
+	}
+	h.presenceMutex.Unlock()
+
+	var warn, kick []*common.Client
+	idleSec := make(map[*common.Client]int, len(players))
+
+	h.InputMutex.Lock()
+	tickDuration := time.Duration(h.tickInterval) * time.Millisecond
+	for client, playerID := range players {
+		// Idle time counts from the first check after joining
+		lastActive, ok := h.lastActive[playerID]
+		if !ok {
+			h.lastActive[playerID] = h.CurrentTick
+			continue
+		}
+
+		idle := int((time.Duration(h.CurrentTick-lastActive) * tickDuration).Seconds())
+		idleSec[client] = idle
+		switch {
+		case h.afkTimeoutSec > 0 && idle >= h.afkTimeoutSec:
+			delete(h.lastActive, playerID)
+			delete(h.afkWarned, playerID)
+			kick = append(kick, client)
+		case h.afkWarningSec > 0 && idle >= h.afkWarningSec && !h.afkWarned[playerID]:
+			h.afkWarned[playerID] = true
+			warn = append(warn, client)
+		}
+	}
+	h.InputMutex.Unlock()
+
+	for _, client := range warn {
+		warning := types.AFKMessage{Type: types.MessageTypeAFKWarning, IdleSec: idleSec[client], Action: string(h.afkAction)}
+		if h.afkTimeoutSec > 0 {
+			warning.ActionInSec = h.afkTimeoutSec - idleSec[client]
+		}
+		client.Logger().Info("Warned idle player", "idleSec", idleSec[client], "actionInSec", warning.ActionInSec)
+
+		select {
+		case client.SendChan <- warning:
+		default:
+			client.Logger().Warn("Failed to send AFK warning")
+		}
+	}
+
+	for _, client := range kick {
+		h.kickIdle(client, idleSec[client])
+	}
+}
+
+// kickIdle moves an idle player to the spectators or disconnects them,
+// depending on the AFK action, from within Run
+func (h *Hub) kickIdle(client *common.Client, idleSec int) {
+	h.Metrics.AFKKicks.Add(string(h.afkAction), 1)
+
+	select {
+	case client.SendChan <- types.AFKMessage{Type: types.MessageTypeAFKKick, IdleSec: idleSec, Action: string(h.afkAction)}:
+	default:
+		client.Logger().Warn("Failed to send AFK kick message")
+	}
+
+	// Idle players give up their slot at once, without a reconnect grace period
+	h.presenceMutex.Lock()
+	h.leaveLocked(client, 0)
+	h.presenceMutex.Unlock()
+
+	if h.afkAction == AFKDisconnect {
+		client.Logger().Info("Disconnecting idle player", "idleSec", idleSec)
+		h.disconnectClient(client, CloseIdle, "idle for too long")
+		return
+	}
+
+	// Spectators over the limit are disconnected instead, the player has to
+	// give up their place either way
+	if !h.makeSpectator(client) {
+		client.Logger().Info("Disconnecting idle player, no room for another spectator", "idleSec", idleSec)
+		h.disconnectClient(client, CloseIdle, "idle for too long")
+		return
+	}
+	client.Logger().Info("Moved idle player to the spectators", "idleSec", idleSec)
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/bans"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+// WebSocket close code sent to banned clients
+const CloseBanned = 4003
+
+// Admin actions on the ban list recorded as admin events
+const (
+	AdminActionBan   = "ban"   // A player ID or IP was banned
+	AdminActionUnban = "unban" // A ban was lifted
+)
+
+// Bans returns the hub's ban list
+func (h *Hub) Bans() *bans.Store {
+	return h.banList
+}
+
+// banMessage is the text banned clients are shown
+func banMessage(ban bans.Ban) string {
+	if ban.Reason == "" {
+		return "you are banned from this server"
+	}
+	return "you are banned from this server: " + ban.Reason
+}
+
+// checkBanned refuses WebSocket upgrades from banned IPs, writing the HTTP
+// error and returning false
+func checkBanned(hub *Hub, w http.ResponseWriter, ip string, logger *slog.Logger) bool {
+	ban, banned := hub.banList.Match("", ip)
+	if !banned {
+		return true
+	}
+
+	logger.Warn("Rejected WebSocket upgrade from banned IP", "ban", ban.ID, "reason", ban.Reason)
+	hub.Metrics.RejectedUpgrades.Add("banned", 1)
+	http.Error(w, banMessage(ban), http.StatusForbidden)
+	return false
+}
+
+// refuseBanned checks whether a client claiming a player ID is banned by its
+// ID or IP, and if so tells it why and closes its connection
+func (h *Hub) refuseBanned(client *common.Client, playerID string) bool {
+	ban, banned := h.banList.Match(playerID, client.RemoteIP)
+	if !banned {
+		return false
+	}
+
+	client.Logger().Warn("Refused banned client", "player", playerID, "ban", ban.ID, "reason", ban.Reason)
+	h.sendError(client, types.ErrorCodeBanned, banMessage(ban))
+	h.Disconnect(client, CloseBanned, "banned")
+	return true
+}
+
+// AddBan bans a player ID or IP, disconnecting the clients it covers and
+// recording the ban in the tick stream
+func (h *Hub) AddBan(ban bans.Ban) (bans.Ban, error) {
+	ban, err := h.banList.Add(ban)
+	if err != nil {
+		return bans.Ban{}, err
+	}
+
+	h.logger.Info("Added ban", "ban", ban.ID, "player", ban.PlayerID, "ip", ban.IP,
+		"reason", ban.Reason, "expiresAt", ban.ExpiresAt)
+	h.RecordEvent(types.GameEvent{Kind: types.EventAdmin, PlayerID: ban.PlayerID, Value: AdminActionBan})
+	h.kickBanned()
+	return ban, nil
+}
+
+// RemoveBan lifts a ban
+func (h *Hub) RemoveBan(id string) (bans.Ban, error) {
+	ban, err := h.banList.Remove(id)
+	if err != nil {
+		return bans.Ban{}, err
+	}
+
+	h.logger.Info("Lifted ban", "ban", ban.ID, "player", ban.PlayerID, "ip", ban.IP, "reason", ban.Reason)
+	h.RecordEvent(types.GameEvent{Kind: types.EventAdmin, PlayerID: ban.PlayerID, Value: AdminActionUnban})
+	return ban, nil
+}
+
+// ReloadBans reads the ban file again and disconnects the clients covered
+// by the bans added to it
+func (h *Hub) ReloadBans() error {
+	if err := h.banList.Reload(); err != nil {
+		return err
+	}
+
+	h.logger.Info("Reloaded ban list", "bans", len(h.banList.List()))
+	h.kickBanned()
+	return nil
+}
+
+// kickBanned disconnects every connected client a ban covers
+func (h *Hub) kickBanned() {
+	h.ClientsMutex.Lock()
+	clients := make([]*common.Client, 0, len(h.Clients)+len(h.delayedClients))
+	for client := range h.Clients {
+		clients = append(clients, client)
+	}
+	for client := range h.delayedClients {
+		clients = append(clients, client)
+	}
+	h.ClientsMutex.Unlock()
+
+	// Clients are matched by the player ID they joined or queued as, those
+	// that haven't claimed one only by their IP
+	h.presenceMutex.Lock()
+	playerIDs := make(map[*common.Client]string, len(h.joined)+len(h.queue))
+	for client, playerID := range h.joined {
+		playerIDs[client] = playerID
+	}
+	for _, queued := range h.queue {
+		playerIDs[queued.client] = queued.playerID
+	}
+	h.presenceMutex.Unlock()
+
+	for _, client := range clients {
+		h.refuseBanned(client, playerIDs[client])
+	}
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/wire"
+)
+
+// binaryMessage is a message with a binary encoding, written as a binary
+// frame to clients that negotiated the binary capability
+type binaryMessage interface {
+	common.ClientMessage
+	binaryFrame() []byte
+}
+
+// tickFrame is a tick message together with its binary encoding, encoded
+// once by the hub rather than by every client's write pump
+type tickFrame struct {
+	types.TickMessage
+	frame []byte
+}
+
+func (m tickFrame) binaryFrame() []byte {
+	return m.frame
+}
+
+// playerTableFrame is a player table message together with its binary encoding
+type playerTableFrame struct {
+	types.PlayerTableMessage
+	frame []byte
+}
+
+func (m playerTableFrame) binaryFrame() []byte {
+	return m.frame
+}
+
+// sendPlayerTable sends the player table of the running match to a client
+// that negotiated binary frames
+//
+// The table is queued while InputMutex is held, so a tick defining players
+// missing from it can't be encoded in between and reach the client first as
+// JSON, leaving its decoder without their indexes.
+func (h *Hub) sendPlayerTable(client *common.Client) {
+	h.InputMutex.Lock()
+	defer h.InputMutex.Unlock()
+
+	players := h.players.Players()
+
+	tableMsg := playerTableFrame{
+		PlayerTableMessage: types.PlayerTableMessage{
+			Type:    types.MessageTypePlayerTable,
+			Players: players,
+		},
+		frame: wire.EncodePlayers(nil, players),
+	}
+
+	select {
+	case client.SendChan <- tableMsg:
+		client.Logger().Debug("Player table sent", "players", len(players))
+	default:
+		client.Logger().Warn("Failed to send player table")
+	}
+}
@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/wire"
+)
+
+// addTestInputs queues an input from each player for the next tick
+func addTestInputs(hub *Hub, playerIDs ...string) {
+	hub.InputMutex.Lock()
+	defer hub.InputMutex.Unlock()
+	for _, playerID := range playerIDs {
+		hub.CurrentInputs = append(hub.CurrentInputs, types.PlayerInput{PlayerID: playerID, Up: true})
+	}
+}
+
+// TestPlayerTableOrderedWithTicks sends the player table to a client joining
+// while a tick bringing in a new player is encoded and broadcast, and decodes
+// what the client receives the way a binary client would
+func TestPlayerTableOrderedWithTicks(t *testing.T) {
+	// A large table takes long enough to encode for the tick to overtake it
+	// if the two aren't ordered
+	players := make([]string, 100000)
+	for i := range players {
+		players[i] = fmt.Sprintf("player%d", i)
+	}
+
+	for round := range 20 {
+		hub := NewHub()
+		addTestInputs(hub, players...)
+		hub.processGameTick()
+		<-hub.Broadcast
+
+		client := &common.Client{SendChan: make(chan common.ClientMessage, 4)}
+		client.SetLogger(hub.ClientLogger("binary"))
+
+		// The client joins just before a new player's first tick is
+		// broadcast, which Run delivers to the client. Both wait for the
+		// inputs, the table first.
+		addTestInputs(hub, "newcomer")
+		hub.InputMutex.Lock()
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			hub.sendPlayerTable(client)
+		}()
+		time.Sleep(time.Millisecond)
+		go func() {
+			defer wg.Done()
+			hub.processGameTick()
+			client.SendChan <- <-hub.Broadcast
+		}()
+		time.Sleep(time.Millisecond)
+		hub.InputMutex.Unlock()
+		wg.Wait()
+
+		// And plays on
+		addTestInputs(hub, "newcomer")
+		hub.processGameTick()
+		client.SendChan <- <-hub.Broadcast
+		close(client.SendChan)
+
+		// The client switches to binary frames at the table
+		var decoder wire.Decoder
+		binary := false
+		for message := range client.SendChan {
+			switch message := message.(type) {
+			case playerTableFrame:
+				binary = true
+				if _, err := decoder.Decode(message.binaryFrame()); err != nil {
+					t.Fatalf("round %d: error decoding player table: %v", round, err)
+				}
+			case tickFrame:
+				if !binary {
+					continue
+				}
+				tick, err := decoder.Decode(message.binaryFrame())
+				if err != nil {
+					t.Fatalf("round %d: error decoding tick %d: %v", round, message.Tick.Tick, err)
+				}
+				for i, input := range tick.Inputs {
+					if want := message.Tick.Inputs[i].PlayerID; input.PlayerID != want {
+						t.Fatalf("round %d: tick %d decoded input from %s, want %s", round, message.Tick.Tick, input.PlayerID, want)
+					}
+				}
+			}
+		}
+		if !binary {
+			t.Fatalf("round %d: client never received the player table", round)
+		}
+	}
+}
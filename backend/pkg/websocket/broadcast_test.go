@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+// Connections and players of a broadcast benchmark
+const (
+	broadcastClients = 500
+	broadcastPlayers = 500
+)
+
+// BenchmarkBroadcast writes a tick to every connection the way the write
+// pumps do, with and without prepared messages, binary frames and
+// compression
+func BenchmarkBroadcast(b *testing.B) {
+	hub := NewHub()
+	frame := newBenchmarkTick(broadcastPlayers)
+
+	cases := []struct {
+		name     string
+		compress bool
+		prepare  bool
+		binary   bool
+	}{
+		{"json per client", false, false, false},
+		{"json prepared", false, true, false},
+		{"binary prepared", false, true, true},
+		{"json per client + deflate", true, false, false},
+		{"json prepared + deflate", true, true, false},
+		{"binary prepared + deflate", true, true, true},
+	}
+
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			conns, written := dialBenchmarkClients(b, broadcastClients, c.compress)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := written.Load()
+			for range b.N {
+				var message common.ClientMessage = frame
+				if c.prepare {
+					message = hub.prepare(frame)
+				}
+				for _, conn := range conns {
+					if _, err := writeMessage(conn, message, c.binary); err != nil {
+						b.Fatalf("error writing message: %v", err)
+					}
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(written.Load()-start)/float64(b.N*len(conns)), "wireB/client")
+		})
+	}
+}
+
+// newBenchmarkTick builds a tick frame with random inputs from about half
+// of the given number of players, all of them already in the player table
+// as they would be mid-match
+func newBenchmarkTick(players int) tickFrame {
+	random := rand.New(rand.NewSource(1))
+	table := wire.NewPlayerTable()
+	tick := types.GameTick{Tick: 12_345}
+
+	for i := range players {
+		playerID := fmt.Sprintf("player-%04d", i)
+		table.Index(playerID)
+		if random.Intn(2) == 0 {
+			continue
+		}
+		tick.Inputs = append(tick.Inputs, types.PlayerInput{
+			PlayerID:  playerID,
+			Up:        random.Intn(2) == 0,
+			Down:      random.Intn(2) == 0,
+			Left:      random.Intn(2) == 0,
+			Right:     random.Intn(2) == 0,
+			PlaceBlob: random.Intn(8) == 0,
+		})
+	}
+
+	return tickFrame{
+		TickMessage: types.TickMessage{Type: types.MessageTypeTick, Tick: tick},
+		frame:       wire.EncodeTick(nil, tick, table),
+	}
+}
+
+// dialBenchmarkClients opens the given number of WebSocket connections to a
+// local server, returning the server side of each and a count of the bytes
+// the server has written, all closed when the benchmark ends
+func dialBenchmarkClients(b *testing.B, clients int, compress bool) ([]*websocket.Conn, *atomic.Uint64) {
+	b.Helper()
+
+	upgrader := websocket.Upgrader{EnableCompression: compress}
+	accepted := make(chan *websocket.Conn)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- conn
+	}))
+
+	written := &atomic.Uint64{}
+	server.Listener = &countingListener{Listener: server.Listener, written: written}
+	server.Start()
+	b.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{EnableCompression: compress}
+	url := "ws" + server.URL[len("http"):]
+
+	conns := make([]*websocket.Conn, 0, clients)
+	for range clients {
+		peer, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			b.Fatalf("error connecting client: %v", err)
+		}
+		conn := <-accepted
+		b.Cleanup(func() {
+			conn.Close()
+			peer.Close()
+		})
+		conns = append(conns, conn)
+
+		// Drain everything the server sends
+		go func() {
+			for {
+				_, reader, err := peer.NextReader()
+				if err != nil {
+					return
+				}
+				io.Copy(io.Discard, reader)
+			}
+		}()
+	}
+	return conns, written
+}
+
+// countingListener counts the bytes written to the connections it accepts
+type countingListener struct {
+	net.Listener
+	written *atomic.Uint64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, written: l.written}, nil
+}
+
+// countingConn counts the bytes written to a connection
+type countingConn struct {
+	net.Conn
+	written *atomic.Uint64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"errors"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/chat"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+// PostChat checks a chat message from a player and broadcasts it, recording
+// it in the tick stream for replays, or tells the player why it was refused
+func (h *Hub) PostChat(client *common.Client, text string) {
+	h.presenceMutex.Lock()
+	playerID, joined := h.joined[client]
+	h.presenceMutex.Unlock()
+	if !joined {
+		client.Logger().Debug("Refused chat message from a client that hasn't joined")
+		h.sendError(client, types.ErrorCodeNotJoined, "send your player ID before chatting")
+		return
+	}
+
+	chatMsg, err := h.chat.Post(playerID, text, h.tick.Load(), time.Now())
+	if err != nil {
+		client.Logger().Info("Refused chat message", "reason", err, "text", text)
+		h.sendError(client, chatErrorCode(err), err.Error())
+		return
+	}
+
+	client.Logger().Info("Chat message", "text", chatMsg.Text)
+	h.RecordEvent(types.GameEvent{Kind: types.EventChat, PlayerID: playerID, Value: chatMsg.Text})
+
+	select {
+	case h.Broadcast <- chatMsg:
+	default:
+		h.Metrics.HubBroadcastDrops.Add(1)
+		client.Logger().Warn("Failed to broadcast chat message")
+	}
+}
+
+// SendChatHistoryToClient sends the recent chat messages, if any, to a single client
+func (h *Hub) SendChatHistoryToClient(client *common.Client) {
+	history := h.chat.History()
+	if len(history) == 0 {
+		return
+	}
+
+	select {
+	case client.SendChan <- types.ChatHistoryMessage{Type: types.MessageTypeChatHistory, Messages: history}:
+		client.Logger().Debug("Sent chat history", "messages", len(history))
+	default:
+		client.Logger().Warn("Failed to send chat history")
+	}
+}
+
+// chatErrorCode returns the error code telling a player why their chat
+// message was refused
+func chatErrorCode(err error) string {
+	switch {
+	case errors.Is(err, chat.ErrEmpty):
+		return types.ErrorCodeChatEmpty
+	case errors.Is(err, chat.ErrTooLong):
+		return types.ErrorCodeChatTooLong
+	case errors.Is(err, chat.ErrRateLimited):
+		return types.ErrorCodeChatRateLimit
+	default:
+		return types.ErrorCodeChatBlocked
+	}
+}
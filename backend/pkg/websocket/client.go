@@ -1,9 +1,17 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
@@ -22,203 +30,437 @@ const (
 	// Send pings to peer with this period (must be less than pongWait)
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer
-	maxMessageSize = 512
+	// Maximum message size allowed from peer, enough for a chat message of
+	// the longest allowed length in multi-byte characters
+	maxMessageSize = 4096
 )
 
+// SupportedSubprotocols lists the WebSocket subprotocols the server speaks,
+// one per protocol version, newest first. Clients may offer one with
+// Sec-WebSocket-Protocol to declare the version they speak, or offer none at
+// all and state it in their hello.
+var SupportedSubprotocols = []string{"blobberman.v2", "blobberman.v1"}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// Allow all origins
+	Subprotocols:    SupportedSubprotocols,
+	// Origins are checked against the hub's OriginPolicy before upgrading
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-// HandleWebSocket handles WebSocket requests from clients with default no-op logger
+// checkUpgrade refuses WebSocket upgrades from disallowed origins or for
+// unsupported subprotocols, writing the HTTP error and returning false
+func checkUpgrade(hub *Hub, w http.ResponseWriter, r *http.Request, logger *slog.Logger) bool {
+	if !hub.originPolicy.Load().Allowed(r) {
+		logger.Warn("Rejected WebSocket upgrade from disallowed origin", "origin", r.Header.Get("Origin"))
+		hub.Metrics.RejectedUpgrades.Add("origin", 1)
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return false
+	}
+
+	if offered := websocket.Subprotocols(r); len(offered) > 0 && !slices.ContainsFunc(offered, func(protocol string) bool {
+		return slices.Contains(SupportedSubprotocols, protocol)
+	}) {
+		logger.Warn("Rejected WebSocket upgrade with unsupported subprotocols", "subprotocols", offered)
+		hub.Metrics.RejectedUpgrades.Add("subprotocol", 1)
+		http.Error(w, "Unsupported subprotocol, supported: "+strings.Join(SupportedSubprotocols, ", "), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// offersDeflate reports whether the client offered the permessage-deflate
+// extension, which the upgrader accepts when compression is enabled
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HandleWebSocket handles WebSocket requests from clients with a discarding logger
 func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	HandleWebSocketWithDebug(hub, w, r, common.NoopDebugLogger)
+	HandleWebSocketWithDebug(hub, w, r, slog.New(slog.NewTextHandler(io.Discard, nil)))
 }
 
-// HandleWebSocketWithDebug handles WebSocket requests from clients with debug logging
-func HandleWebSocketWithDebug(hub *Hub, w http.ResponseWriter, r *http.Request, debugLog common.DebugLoggerFunc) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println(err)
-		debugLog("Failed to upgrade connection: %v", err)
+// HandleWebSocketWithDebug handles WebSocket requests from clients, logging
+// the upgrade to the given logger and client activity to the hub's logger
+func HandleWebSocketWithDebug(hub *Hub, w http.ResponseWriter, r *http.Request, logger *slog.Logger) {
+	ip := hub.proxyPolicy.Load().ClientIP(r)
+	logger = logger.With("remoteAddr", r.RemoteAddr, "clientIP", ip)
+
+	if !checkUpgrade(hub, w, r, logger) || !checkBanned(hub, w, ip, logger) {
+		return
+	}
+
+	// Clients may connect as spectators to watch without joining the match
+	role := types.Role(r.URL.Query().Get("role"))
+	if role != "" && role != types.RolePlayer && role != types.RoleSpectator {
+		logger.Warn("Rejected WebSocket upgrade with unknown role", "role", role)
+		hub.Metrics.RejectedUpgrades.Add("role", 1)
+		http.Error(w, "Unknown role, use player or spectator", http.StatusBadRequest)
 		return
 	}
 
-	remoteAddr := r.RemoteAddr
-	debugLog("Connection from %s upgraded to WebSocket", remoteAddr)
+	client, conn := upgradeClient(hub, w, r, ip, logger)
+	if client == nil {
+		return
+	}
+	client.Spectator.Store(role == types.RoleSpectator)
+	client.Logger().Debug("Assigned temporary client ID", "spectator", client.Spectator.Load())
+
+	startClient(hub, client, conn, hub.Register, readPump)
+}
+
+// upgradeClient upgrades the connection to a WebSocket and creates its
+// client, it returns a nil client if the client IP is over its connection
+// limits or the upgrade failed
+//
+// The connection counts towards the limits of the client IP until startClient
+// sees it close.
+func upgradeClient(hub *Hub, w http.ResponseWriter, r *http.Request, ip string, logger *slog.Logger) (*common.Client, *websocket.Conn) {
+	if reason, retryAfter := hub.ipLimiter.Acquire(ip); reason != IPLimitNone {
+		logger.Warn("Rejected WebSocket upgrade over the connection limits", "reason", reason)
+		hub.Metrics.RejectedUpgrades.Add(string(reason), 1)
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		http.Error(w, "Too many connections", http.StatusTooManyRequests)
+		return nil, nil
+	}
+
+	// Negotiate permessage-deflate with clients that offer it, unless
+	// compression has been turned off
+	wsUpgrader := upgrader
+	wsUpgrader.EnableCompression = hub.compression.Load()
+	compressed := wsUpgrader.EnableCompression && offersDeflate(r)
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		hub.ipLimiter.Release(ip)
+		logger.Warn("Failed to upgrade connection", "error", err)
+		return nil, nil
+	}
+
+	logger.Debug("Connection upgraded to WebSocket", "subprotocol", conn.Subprotocol(), "compressed", compressed)
 
 	// Generate a temporary client ID
 	// The client will send their persistent ID after connection
 	tempClientID := "temp-" + uuid.New().String()
-	debugLog("Assigned temporary client ID %s to connection from %s", tempClientID, remoteAddr)
 
 	// Create a new client
 	client := &common.Client{
 		Hub:      hub,
 		ID:       tempClientID,
 		SendChan: make(chan common.ClientMessage, 256),
-		DebugLog: debugLog,
+
+		Subprotocol:     conn.Subprotocol(),
+		RemoteIP:        ip,
+		ProtocolVersion: subprotocolVersion(conn.Subprotocol()),
+		Compressed:      compressed,
 	}
+	client.SetLogger(hub.ClientLogger(tempClientID).With("remoteAddr", r.RemoteAddr, "clientIP", ip))
+	return client, conn
+}
 
-	// Register client with hub
-	hub.Register <- client
+// startClient registers the client with the hub on the given channel and
+// starts its pumps, unless the hub has already shut down, releasing the
+// client's connection from the limits of its IP once the read pump ends
+func startClient(hub *Hub, client *common.Client, conn *websocket.Conn, register chan<- *common.Client,
+	read func(*common.Client, *Hub, *websocket.Conn)) {
+	hub.pumps.Add(1)
+	select {
+	case register <- client:
+	case <-hub.done:
+		hub.pumps.Done()
+		hub.ipLimiter.Release(client.RemoteIP)
+		client.Logger().Debug("Hub has shut down, refusing connection")
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
 
 	// Start goroutines for pumping messages
-	go writePump(client, conn)
-	go readPump(client, hub, conn)
+	go writePump(client, hub, conn)
+	go func() {
+		defer hub.ipLimiter.Release(client.RemoteIP)
+		read(client, hub, conn)
+	}()
 }
 
 // readPump pumps messages from the WebSocket connection to the hub
 func readPump(client *common.Client, hub *Hub, conn *websocket.Conn) {
 	defer func() {
-		hub.Unregister <- client
+		select {
+		case hub.Unregister <- client:
+		case <-hub.done:
+		}
 		conn.Close()
 	}()
 
 	conn.SetReadLimit(maxMessageSize)
 	conn.SetReadDeadline(time.Now().Add(pongWait))
 	conn.SetPongHandler(func(string) error {
-		client.DebugLog("Received pong from client %s", client.ID)
+		client.Logger().Debug("Received pong")
 		conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 
-	client.DebugLog("Started reading messages from client %s", client.ID)
+	client.Logger().Debug("Started reading messages")
+
+	// Whether the client's protocol version has been settled, by a hello or
+	// by accepting it without one, and whether it has been refused
+	negotiated := false
+	refused := false
 
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
-				client.DebugLog("Unexpected close error for client %s: %v", client.ID, err)
+				client.Logger().Warn("Unexpected close error", "error", err)
 			} else {
-				client.DebugLog("Connection closed for client %s", client.ID)
+				client.Logger().Debug("Connection closed")
 			}
 			break
 		}
 
-		client.DebugLog("Received message from client %s: %s", client.ID, string(message))
+		if refused {
+			// Waiting for the write pump to close the connection
+			continue
+		}
+
+		client.Logger().Debug("Received message", "message", string(message))
 
 		// Try to decode the message type first to determine handling
 		var baseMsg struct {
 			Type types.MessageType `json:"type"`
 		}
 		if err := json.Unmarshal(message, &baseMsg); err != nil {
-			log.Printf("Error decoding message type: %v", err)
-			client.DebugLog("Error decoding message type from client %s: %v", client.ID, err)
+			client.Logger().Warn("Error decoding message type", "error", err)
+			continue
+		}
+
+		// Clients state their protocol version with a hello before anything else
+		if baseMsg.Type == types.MessageTypeHello {
+			var helloMsg types.HelloMessage
+			if err := json.Unmarshal(message, &helloMsg); err != nil {
+				client.Logger().Warn("Error decoding hello message", "error", err)
+				continue
+			}
+			if negotiated {
+				client.Logger().Warn("Ignoring repeated hello message")
+				continue
+			}
+
+			negotiated = true
+			refused = !hub.negotiate(client, helloMsg)
 			continue
 		}
+		if !negotiated {
+			negotiated = true
+			if refused = !hub.acceptWithoutHello(client); refused {
+				continue
+			}
+		}
 
 		// Handle different message types
 		switch baseMsg.Type {
 		case types.MessageTypeInput:
+			if client.Spectator.Load() {
+				client.Logger().Debug("Rejected input from spectator")
+				hub.sendError(client, types.ErrorCodeSpectatorInput, "spectators can't send input")
+				continue
+			}
+			if client.Queued.Load() {
+				hub.sendError(client, types.ErrorCodeQueued, "waiting for a free slot")
+				continue
+			}
+
 			// Handle input message
 			var inputMsg types.InputMessage
 			if err := json.Unmarshal(message, &inputMsg); err != nil {
-				log.Printf("Error decoding input message: %v", err)
-				client.DebugLog("Error decoding input message from client %s: %v", client.ID, err)
+				client.Logger().Warn("Error decoding input message", "error", err)
 				continue
 			}
 
 			// Ensure the player ID matches the client ID
 			if inputMsg.Input.PlayerID != client.ID {
-				client.DebugLog("Player ID mismatch: got %s, expected %s", inputMsg.Input.PlayerID, client.ID)
+				client.Logger().Debug("Player ID mismatch in input message", "playerId", inputMsg.Input.PlayerID)
 				inputMsg.Input.PlayerID = client.ID
 			}
 
 			// Debug log the input
-			inputJson, _ := json.Marshal(inputMsg.Input)
-			client.DebugLog("Valid input from client %s: %s", client.ID, string(inputJson))
+			if client.Logger().Enabled(context.Background(), slog.LevelDebug) {
+				inputJson, _ := json.Marshal(inputMsg.Input)
+				client.Logger().Debug("Valid input", "input", string(inputJson))
+			}
 
 			// Add input to the current tick
 			hub.AddInput(inputMsg.Input)
 
 		case types.MessageTypeDisplayName:
+			if client.Spectator.Load() {
+				client.Logger().Debug("Rejected display name from spectator")
+				hub.sendError(client, types.ErrorCodeSpectatorInput, "spectators can't pick a display name")
+				continue
+			}
+
 			// Handle display name message
 			var displayNameMsg types.DisplayNameMessage
 			if err := json.Unmarshal(message, &displayNameMsg); err != nil {
-				log.Printf("Error decoding display name message: %v", err)
-				client.DebugLog("Error decoding display name message from client %s: %v", client.ID, err)
+				client.Logger().Warn("Error decoding display name message", "error", err)
 				continue
 			}
 
 			// Ensure the player ID matches the client ID
 			if displayNameMsg.PlayerID != client.ID {
-				client.DebugLog("Player ID mismatch in display name message: got %s, expected %s",
-					displayNameMsg.PlayerID, client.ID)
+				client.Logger().Debug("Player ID mismatch in display name message", "playerId", displayNameMsg.PlayerID)
 				displayNameMsg.PlayerID = client.ID
 			}
 
 			// Update display name in the hub
-			client.DebugLog("Updating display name for client %s: %s", client.ID, displayNameMsg.DisplayName)
-			hub.UpdateDisplayName(client.ID, displayNameMsg.DisplayName)
+			client.Logger().Debug("Updating display name", "displayName", displayNameMsg.DisplayName)
+			if err := hub.UpdateDisplayName(client.ID, displayNameMsg.DisplayName); err != nil {
+				client.Logger().Info("Refused display name", "reason", err, "displayName", displayNameMsg.DisplayName)
+				hub.sendError(client, nameErrorCode(err), err.Error())
+			}
 
 		case types.MessageTypeClientId:
 			// Handle client ID message
 			var clientIdMsg types.ClientIdMessage
 			if err := json.Unmarshal(message, &clientIdMsg); err != nil {
-				log.Printf("Error decoding client ID message: %v", err)
-				client.DebugLog("Error decoding client ID message from client %s: %v", client.ID, err)
+				client.Logger().Warn("Error decoding client ID message", "error", err)
 				continue
 			}
 
 			oldId := client.ID
 			newId := clientIdMsg.PlayerID
 
-			// Update the client's ID
-			client.DebugLog("Updating client ID from %s to %s", oldId, newId)
+			// Banned players are refused before they take a slot
+			if hub.refuseBanned(client, newId) {
+				refused = true
+				continue
+			}
+
+			// Take the player's slot in the match, telling everyone else, or
+			// wait in line for one
+			sessionToken, position, err := hub.Join(client, newId, clientIdMsg.SessionToken, clientIdMsg.PriorityToken)
+			if err != nil {
+				client.Logger().Info("Refused client ID", "reason", err, "player", newId)
+				hub.sendError(client, types.ErrorCodeSessionInvalid, err.Error())
+				continue
+			}
 
 			// Transfer any data associated with the old ID to the new ID
 			hub.UpdateClientId(oldId, newId)
 
-			// Update the client's ID
+			// Update the client's ID and tag its log records with the new one
 			client.ID = newId
+			client.SetLogger(hub.ClientLogger(newId))
+			client.Logger().Info("Client ID updated", "oldClient", oldId)
+
+			// Confirm the client ID update and catch the client up again
+			hub.welcome(client, newId, sessionToken)
 
-			// Optional: Log the ID update to server logs
-			log.Printf("Client ID updated: %s -> %s", oldId, newId)
+			// Tell the client who is online
+			hub.SendRosterToClient(client)
 
-			// Send a new connect message to confirm the client ID update
-			connectMsg := types.ConnectMessage{
-				Type:         types.MessageTypeConnect,
-				PlayerID:     client.ID,
-				MaxTicks:     hub.maxHistorySize,
-				TickInterval: hub.tickInterval,
+			// Tell a queued client how long it has to wait
+			if position > 0 {
+				hub.SendQueuePositionToClient(client)
 			}
 
-			select {
-			case client.SendChan <- connectMsg:
-				client.DebugLog("Connect message sent to client after ID update %s", client.ID)
-			default:
-				client.DebugLog("Failed to send connect message to client after ID update %s", client.ID)
+		case types.MessageTypeChat:
+			if client.Spectator.Load() {
+				client.Logger().Debug("Rejected chat message from spectator")
+				hub.sendError(client, types.ErrorCodeSpectatorInput, "spectators can't chat")
+				continue
+			}
+			if client.Queued.Load() {
+				hub.sendError(client, types.ErrorCodeQueued, "waiting for a free slot")
+				continue
+			}
+
+			var chatMsg types.ChatMessage
+			if err := json.Unmarshal(message, &chatMsg); err != nil {
+				client.Logger().Warn("Error decoding chat message", "error", err)
+				continue
 			}
 
-			// Send history to the client again
-			hub.sendHistoryToClient(client)
+			hub.PostChat(client, chatMsg.Text)
 
-			// Send current display names to the client
-			hub.SendDisplayNamesToClient(client)
+		case types.MessageTypeMatchResult:
+			var resultMsg types.MatchResultMessage
+			if err := json.Unmarshal(message, &resultMsg); err != nil {
+				client.Logger().Warn("Error decoding match result", "error", err)
+				continue
+			}
+
+			hub.ReportResult(client, resultMsg)
 
 		default:
-			client.DebugLog("Unknown message type from client %s: %s", client.ID, baseMsg.Type)
+			client.Logger().Debug("Unknown message type", "type", baseMsg.Type)
 		}
 	}
 }
 
+// errEncoding wraps errors encoding a message, which don't end the connection
+var errEncoding = errors.New("error encoding message")
+
+// writeMessage writes a single message as one WebSocket frame and returns
+// the size of its uncompressed payload
+//
+// With binary set the binary encoding of the messages that have one is
+// written, everything else is JSON. Broadcasts arrive already encoded, and
+// compressed, once for every client.
+func writeMessage(conn *websocket.Conn, message common.ClientMessage, binary bool) (int, error) {
+	if prepared, ok := message.(preparedMessage); ok {
+		if prepared.binary != nil && binary {
+			return prepared.binarySize, conn.WritePreparedMessage(prepared.binary)
+		}
+		return prepared.textSize, conn.WritePreparedMessage(prepared.text)
+	}
+
+	if binaryMsg, ok := message.(binaryMessage); ok && binary {
+		frame := binaryMsg.binaryFrame()
+		return len(frame), conn.WriteMessage(websocket.BinaryMessage, frame)
+	}
+
+	// Marshal the message to JSON here, right before sending
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errEncoding, err)
+	}
+	return len(messageBytes), conn.WriteMessage(websocket.TextMessage, messageBytes)
+}
+
 // writePump pumps messages from the hub to the WebSocket connection
-func writePump(client *common.Client, conn *websocket.Conn) {
+func writePump(client *common.Client, hub *Hub, conn *websocket.Conn) {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		conn.Close()
-		client.DebugLog("Write pump for client %s terminated", client.ID)
+		hub.pumps.Done()
+		client.Logger().Debug("Write pump terminated")
 	}()
 
-	client.DebugLog("Started writing messages to client %s", client.ID)
+	client.Logger().Debug("Started writing messages")
+
+	// Binary ticks refer to players by their index in the player table, so
+	// a client that negotiated them only gets them from the player table
+	// that catches it up onwards. Ticks queued before it are written as JSON.
+	binary := false
 
 	for {
 		select {
@@ -226,32 +468,36 @@ func writePump(client *common.Client, conn *websocket.Conn) {
 			conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel
-				client.DebugLog("Send channel closed for client %s, closing connection", client.ID)
-				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				client.Logger().Debug("Send channel closed, closing connection", "closeCode", client.CloseCode)
+				closeCode := client.CloseCode
+				if closeCode == 0 {
+					closeCode = websocket.CloseNormalClosure
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, client.CloseReason))
 				return
 			}
 
-			// Marshal the message to JSON here, right before sending
-			messageBytes, err := json.Marshal(message)
-			if err != nil {
-				client.DebugLog("Error marshalling message for client %s: %v", client.ID, err)
-				continue
+			if _, ok := message.(playerTableFrame); ok {
+				binary = client.HasCapability(CapabilityBinary)
 			}
 
-			// Write as a single message
-			err = conn.WriteMessage(websocket.TextMessage, messageBytes)
-			if err != nil {
-				client.DebugLog("Error writing message to client %s: %v", client.ID, err)
+			size, err := writeMessage(conn, message, binary)
+			if errors.Is(err, errEncoding) {
+				client.Logger().Error("Error marshalling message", "type", message.GetType(), "error", err)
+				continue
+			} else if err != nil {
+				client.Logger().Debug("Error writing message", "error", err)
 				return
 			}
+			hub.Metrics.AddBytesSent(message.GetType(), size)
 
-			client.DebugLog("Successfully wrote message of type %s to client %s", message.GetType(), client.ID)
+			client.Logger().Debug("Wrote message", "type", message.GetType())
 
 		case <-ticker.C:
 			conn.SetWriteDeadline(time.Now().Add(writeWait))
-			client.DebugLog("Sending ping to client %s", client.ID)
+			client.Logger().Debug("Sending ping")
 			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				client.DebugLog("Error sending ping to client %s: %v", client.ID, err)
+				client.Logger().Debug("Error sending ping", "error", err)
 				return
 			}
 		}
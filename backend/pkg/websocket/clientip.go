@@ -0,0 +1,139 @@
+package websocket
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ProxyPolicy decides which peers are trusted reverse proxies, whose
+// Forwarded and X-Forwarded-For headers name the client they connect for
+//
+// The headers are only read from requests arriving from a trusted proxy, and
+// are walked from the nearest hop backwards, skipping further trusted
+// proxies, so a client can't pick its own address by sending the headers
+// itself.
+type ProxyPolicy struct {
+	trusted []netip.Prefix
+}
+
+// ParseTrustedProxies parses trusted proxy addresses, each either a single IP
+// address or a CIDR range
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// NewProxyPolicy creates a policy trusting the given proxy ranges
+func NewProxyPolicy(trusted []netip.Prefix) *ProxyPolicy {
+	return &ProxyPolicy{trusted: trusted}
+}
+
+// Trusted reports whether an address belongs to a trusted proxy
+func (p *ProxyPolicy) Trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client a request comes from, taken
+// from the forwarding headers when it arrived through trusted proxies
+//
+// The standard Forwarded header is preferred over X-Forwarded-For when both
+// are present. The peer address is used when there are no forwarding hops,
+// and the last hop is used if every hop is a trusted proxy.
+func (p *ProxyPolicy) ClientIP(r *http.Request) string {
+	peer, ok := parseIP(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !p.Trusted(peer) {
+		return peer.String()
+	}
+
+	hops := forwardedFor(r.Header)
+	if hops == nil {
+		hops = xForwardedFor(r.Header)
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseIP(hops[i])
+		if !ok {
+			// Obfuscated or unknown hops can't be traced any further
+			break
+		}
+		client = addr
+		if !p.Trusted(addr) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor returns the for= parameters of the Forwarded headers in
+// order, or nil if there are none
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, node, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(node, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// xForwardedFor returns the addresses of the X-Forwarded-For headers in order
+func xForwardedFor(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseIP parses an address that may carry a port, with IPv6 addresses in
+// brackets when it does
+func parseIP(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
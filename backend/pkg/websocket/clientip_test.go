@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProxyPolicyClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewProxyPolicy(trusted)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:5000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer spoofing X-Forwarded-For",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer spoofing Forwarded",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.1.2.3:80",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "client spoofing a hop before the proxy",
+			remoteAddr: "10.1.2.3:80",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "192.0.2.1:80",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 10.9.9.9"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "every hop trusted",
+			remoteAddr: "10.1.2.3:80",
+			headers:    map[string]string{"X-Forwarded-For": "10.4.5.6"},
+			want:       "10.4.5.6",
+		},
+		{
+			name:       "Forwarded preferred over X-Forwarded-For",
+			remoteAddr: "10.1.2.3:80",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8::1]:4711";proto=https`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:       "obfuscated hop",
+			remoteAddr: "10.1.2.3:80",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1, for=_hidden"},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "IPv4-mapped trusted peer",
+			remoteAddr: "[::ffff:10.1.2.3]:80",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "trusted proxy without headers",
+			remoteAddr: "10.1.2.3:80",
+			want:       "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := policy.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if _, err := ParseTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("parsed invalid trusted proxy %q", proxy)
+		}
+	}
+}
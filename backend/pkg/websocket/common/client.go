@@ -1,7 +1,10 @@
 package common
 
 import (
+	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
 )
@@ -17,5 +20,54 @@ type Client struct {
 	ID       string
 	SendChan chan ClientMessage
 	Mutex    sync.Mutex
-	DebugLog DebugLoggerFunc
+
+	// Logger tagged with the client ID, room and tick, replaced when the
+	// client ID changes while other goroutines log for the client
+	logger atomic.Pointer[slog.Logger]
+
+	// WebSocket subprotocol negotiated during the upgrade, empty if the
+	// client didn't offer one
+	Subprotocol string
+
+	// Whether the client only watches the match, it can become a spectator
+	// after connecting but never goes back to being a player
+	Spectator atomic.Bool
+
+	// Whether the player waits in the join queue of a full room, it can
+	// watch the match but not take part until it is promoted
+	Queued atomic.Bool
+
+	// Address of the client, behind trusted proxies the one they forwarded
+	// for rather than the proxy's
+	RemoteIP string
+
+	// Whether permessage-deflate was negotiated during the upgrade
+	Compressed bool
+
+	// Protocol version and capabilities the client negotiated, the version is
+	// zero until the client's first message, guarded by Mutex
+	ProtocolVersion int
+	Capabilities    []string
+
+	// WebSocket close code and reason sent when the hub closes SendChan,
+	// a normal closure is sent if CloseCode is zero
+	CloseCode   int
+	CloseReason string
+}
+
+// Logger returns the client's logger
+func (c *Client) Logger() *slog.Logger {
+	return c.logger.Load()
+}
+
+// SetLogger replaces the client's logger
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.logger.Store(logger)
+}
+
+// HasCapability reports whether the client negotiated the given capability
+func (c *Client) HasCapability(capability string) bool {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return slices.Contains(c.Capabilities, capability)
 }
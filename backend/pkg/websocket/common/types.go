@@ -6,9 +6,3 @@ import "github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
 type ClientMessage interface {
 	GetType() types.MessageType
 }
-
-// DebugLoggerFunc is a function type for debug logging
-type DebugLoggerFunc func(format string, args ...interface{})
-
-// NoopDebugLogger is a no-op debug logger
-func NoopDebugLogger(format string, args ...interface{}) {}
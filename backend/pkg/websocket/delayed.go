@@ -0,0 +1,221 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+	"github.com/gorilla/websocket"
+)
+
+// How often broadcasts that have waited out the spectator delay are released
+const delayedReleaseInterval = 50 * time.Millisecond
+
+// delayedEntry is a broadcast waiting to be released to the delayed feed
+type delayedEntry struct {
+	at      time.Time
+	message common.ClientMessage // nil marks the start of a new game session
+}
+
+// HandleDelayedWebSocket serves the delayed spectator feed
+//
+// Clients of the delayed feed are spectators that receive every broadcast
+// once the configured spectator delay has passed, so a cast or stream of
+// the match can't be used to see where opponents are right now. They are
+// caught up with the ticks of the match history that are older than the
+// delay when they connect.
+func HandleDelayedWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request, logger *slog.Logger) {
+	ip := hub.proxyPolicy.Load().ClientIP(r)
+	logger = logger.With("remoteAddr", r.RemoteAddr, "clientIP", ip)
+
+	if hub.spectatorDelaySec.Load() <= 0 {
+		http.Error(w, "Delayed spectator feed is disabled", http.StatusNotFound)
+		return
+	}
+
+	if !checkUpgrade(hub, w, r, logger) || !checkBanned(hub, w, ip, logger) {
+		return
+	}
+
+	client, conn := upgradeClient(hub, w, r, ip, logger)
+	if client == nil {
+		return
+	}
+	client.Spectator.Store(true)
+	client.Logger().Debug("Assigned temporary client ID to delayed spectator")
+
+	startClient(hub, client, conn, hub.registerDelayed, readDelayedPump)
+}
+
+// readDelayedPump reads from a delayed feed connection, which may only
+// negotiate its protocol, until it closes
+func readDelayedPump(client *common.Client, hub *Hub, conn *websocket.Conn) {
+	defer func() {
+		select {
+		case hub.Unregister <- client:
+		case <-hub.done:
+		}
+		conn.Close()
+	}()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	negotiated := false
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			client.Logger().Debug("Delayed feed connection closed", "error", err)
+			return
+		}
+
+		var helloMsg types.HelloMessage
+		if err := json.Unmarshal(message, &helloMsg); err != nil || helloMsg.Type != types.MessageTypeHello {
+			client.Logger().Debug("Ignoring message from delayed spectator")
+			continue
+		}
+		if negotiated {
+			client.Logger().Warn("Ignoring repeated hello message")
+			continue
+		}
+		negotiated = true
+		hub.negotiate(client, helloMsg)
+	}
+}
+
+// queueDelayed holds a broadcast back for the delayed feed, a nil message
+// marks the start of a new game session
+//
+// Broadcasts are queued even while the feed is disabled, so that enabling it
+// on reload never lets a new client catch up with recent ticks.
+func (h *Hub) queueDelayed(message common.ClientMessage) {
+	h.delayedQueue = append(h.delayedQueue, delayedEntry{at: time.Now(), message: message})
+}
+
+// releaseDelayed sends the broadcasts that have waited out the spectator
+// delay to the clients of the delayed feed
+func (h *Hub) releaseDelayed() {
+	cutoff := time.Now().Add(-time.Duration(h.spectatorDelaySec.Load()) * time.Second)
+
+	released := 0
+	for released < len(h.delayedQueue) && !h.delayedQueue[released].at.After(cutoff) {
+		released++
+	}
+	if released == 0 {
+		return
+	}
+	entries := h.delayedQueue[:released]
+	h.delayedQueue = append(make([]delayedEntry, 0, len(h.delayedQueue)-released), h.delayedQueue[released:]...)
+
+	h.ClientsMutex.Lock()
+	clients := make([]*common.Client, 0, len(h.delayedClients))
+	for client := range h.delayedClients {
+		clients = append(clients, client)
+	}
+	h.ClientsMutex.Unlock()
+
+	if len(clients) == 0 {
+		return
+	}
+
+	clientsToRemove := make(map[*common.Client]bool)
+	for _, entry := range entries {
+		// Encode each broadcast once for every client, new game sessions are
+		// announced with a connect message like on the live feed
+		var message common.ClientMessage
+		if entry.message != nil {
+			message = h.prepare(entry.message)
+		}
+
+		for _, client := range clients {
+			if clientsToRemove[client] {
+				continue
+			}
+
+			clientMessage := message
+			if clientMessage == nil {
+				clientMessage = h.newDelayedConnectMessage(client)
+			}
+
+			select {
+			case client.SendChan <- clientMessage:
+			default:
+				h.Metrics.ClientBroadcastDrops.Add(1)
+				client.Logger().Warn("Send queue full, removing delayed spectator", "type", clientMessage.GetType())
+				clientsToRemove[client] = true
+			}
+		}
+	}
+
+	if len(clientsToRemove) > 0 {
+		h.ClientsMutex.Lock()
+		for client := range clientsToRemove {
+			if h.delayedClients[client] {
+				delete(h.delayedClients, client)
+				close(client.SendChan)
+			}
+		}
+		h.ClientsMutex.Unlock()
+	}
+}
+
+// addDelayedClient registers a client of the delayed feed from within Run
+// and catches it up with the match history older than the delay
+func (h *Hub) addDelayedClient(client *common.Client) {
+	h.ClientsMutex.Lock()
+	_, spectatorCount := h.countRoles()
+	spectatorCount += len(h.delayedClients)
+	if h.maxSpectators > 0 && spectatorCount >= h.maxSpectators {
+		h.ClientsMutex.Unlock()
+		h.refuseSpectator(client)
+		return
+	}
+	h.delayedClients[client] = true
+	delayedCount := len(h.delayedClients)
+	h.ClientsMutex.Unlock()
+
+	client.Logger().Info("Delayed spectator connected",
+		"delayedSpectators", delayedCount, "delaySec", h.spectatorDelaySec.Load())
+
+	select {
+	case client.SendChan <- h.newDelayedConnectMessage(client):
+	default:
+		client.Logger().Warn("Failed to send connect message")
+	}
+
+	// Only the ticks that have already been released may be sent, which are
+	// those before the first tick still waiting in the queue. After a reset
+	// that is still waiting the history belongs to a match the client
+	// hasn't reached yet, so it gets none.
+	h.InputMutex.Lock()
+	untilTick := h.CurrentTick
+	h.InputMutex.Unlock()
+	for _, entry := range h.delayedQueue {
+		if entry.message == nil {
+			untilTick = 0
+			break
+		}
+		if frame, ok := entry.message.(tickFrame); ok {
+			untilTick = frame.Tick.Tick
+			break
+		}
+	}
+	h.sendHistoryUntil(client, untilTick)
+
+	h.SendDisplayNamesToClient(client)
+	h.SendAnnouncementToClient(client)
+}
+
+// newDelayedConnectMessage creates the connect message for a delayed spectator
+func (h *Hub) newDelayedConnectMessage(client *common.Client) types.ConnectMessage {
+	connectMsg := h.newConnectMessage(client)
+	connectMsg.DelaySec = int(h.spectatorDelaySec.Load())
+	return connectMsg
+}
@@ -0,0 +1,30 @@
+package websocket
+
+import (
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// Admin actions recorded as admin events
+const (
+	AdminActionReload = "reload" // The configuration was reloaded
+)
+
+// RecordEvent queues a server event for the next tick, so it reaches every
+// client and the history at the same point of the match
+func (h *Hub) RecordEvent(event types.GameEvent) {
+	h.InputMutex.Lock()
+	defer h.InputMutex.Unlock()
+
+	h.CurrentEvents = append(h.CurrentEvents, event)
+}
+
+// seedEvent picks the random seed of a new game session, the input mutex
+// must be held
+func (h *Hub) seedEvent() types.GameEvent {
+	seed := rand.Uint32()
+	h.logger.Info("Picked game session seed", "seed", seed)
+	return types.GameEvent{Kind: types.EventSeed, Value: strconv.FormatUint(uint64(seed), 10)}
+}
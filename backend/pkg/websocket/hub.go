@@ -1,24 +1,32 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"io"
+	"log/slog"
+	"math"
+	"net/netip"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/bans"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/chat"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/matches"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/names"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/profiles"
 	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
 	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/wire"
+	"github.com/gorilla/websocket"
 )
 
 // Maximum number of ticks to keep in history
 const DEFAULT_MAX_HISTORY_SIZE = 100_000 // about 30mins of history
 const DEFAULT_TICK_INTERVAL_MS = 50      // 50ms per tick (20Hz)
-
-// DebugLoggerFunc is a function type for debug logging
-type DebugLoggerFunc func(format string, args ...interface{})
-
-// noopDebugLogger is a no-op debug logger
-func noopDebugLogger(format string, args ...interface{}) {}
+const DEFAULT_ROOM = "main"
 
 // ClientMessage is a type that can be sent to clients
 type ClientMessage interface {
@@ -31,14 +39,54 @@ type Client struct {
 	ID       string
 	SendChan chan ClientMessage
 	Mutex    sync.Mutex
-	debugLog DebugLoggerFunc
+	logger   *slog.Logger
 }
 
+// IdlePolicy decides what happens to a match when every client has left
+type IdlePolicy string
+
+const (
+	// IdlePolicyKeep suspends the match and resumes it where it left off
+	IdlePolicyKeep IdlePolicy = "keep"
+	// IdlePolicyReset discards the abandoned match so the next client starts a fresh one
+	IdlePolicyReset IdlePolicy = "reset"
+)
+
 // HubOptions contains configurable options for the Hub
 type HubOptions struct {
-	TickIntervalMs  int
-	MaxHistorySize  uint64
-	ResetTimeoutSec int // Time in seconds to wait before starting a new game session after game over
+	TickIntervalMs    int
+	MaxHistorySize    uint64
+	ResetTimeoutSec   int             // Time in seconds to wait before starting a new game session after game over
+	MinPlayers        int             // Players needed to start a match, see phase.go
+	WaitingTimeoutSec int             // Seconds to wait for MinPlayers before starting with fewer, zero to wait for them
+	StartCountdownSec int             // Seconds of countdown before a match starts, zero to start at once
+	ResetPauseSec     int             // Seconds between clearing a finished match and waiting for players again
+	IdlePolicy        IdlePolicy      // What to do with the match while no clients are connected
+	Room              string          // Name of the room, attached to every log record
+	Announcement      string          // Message of the day shown to players, empty for none
+	AllowedOrigins    []string        // Origin patterns allowed to connect, see OriginPolicy
+	DevMode           bool            // Allow WebSocket connections from any origin
+	RequireHello      bool            // Refuse clients that don't negotiate a protocol version with a hello
+	LegacySessions    bool            // Let legacy clients claim an online player's ID without its session token
+	Compression       bool            // Negotiate permessage-deflate with clients that support it
+	MaxSpectators     int             // Maximum number of spectators, zero for no limit
+	SpectatorDelay    int             // Seconds the delayed spectator feed lags behind, zero to disable it
+	ReconnectGrace    int             // Seconds a disconnected player's slot is held for them, zero to release it at once
+	MaxPlayers        int             // Maximum number of players holding a slot, zero for no limit
+	PriorityTokens    []string        // Tokens letting a client skip ahead of the join queue
+	TrustedProxies    []netip.Prefix  // Reverse proxies whose forwarding headers name the client, see ProxyPolicy
+	MaxConnsPerIP     int             // Maximum concurrent connections from one client IP, zero for no limit
+	ConnsPerMinute    int             // Maximum new connections from one client IP per minute, zero for no limit
+	AdminToken        string          // Bearer token of the admin API, empty to disable it
+	Bans              *bans.Store     // Ban list, only used when the hub is created, nil for an empty one kept in memory
+	Matches           *matches.Store  // Results history, only used when the hub is created, nil for an empty one kept in memory
+	Profiles          *profiles.Store // Player store, only used when the hub is created, nil for an empty one kept in memory
+	AFKWarningSec     int             // Seconds without movement before a player is warned, zero to never warn
+	AFKTimeoutSec     int             // Seconds without movement before the AFK action is taken, zero to never take it
+	AFKAction         AFKAction       // What happens to players idle past the AFK timeout
+	NameMaxLength     int             // Maximum display name length in characters, zero for no limit
+	ReservedNames     []string        // Display names players may not pick, compared case-insensitively
+	Chat              chat.Options
 }
 
 // Hub manages WebSocket client connections and game state
@@ -63,10 +111,15 @@ type Hub struct {
 
 	// Inputs received for the current tick
 	CurrentInputs []types.PlayerInput
+	CurrentEvents []types.GameEvent
 
 	// History of past ticks
 	TickHistory []types.GameTick
 
+	// Player indexes used by binary encoded ticks in the running match,
+	// protected by InputMutex
+	players *wire.PlayerTable
+
 	// Mutex to protect input access
 	InputMutex sync.Mutex
 
@@ -76,8 +129,41 @@ type Hub struct {
 	// Mutex to protect display names access
 	DisplayNamesMutex sync.Mutex
 
-	// Debug logger function
-	debugLog common.DebugLoggerFunc
+	// Online players of the match and the player each client joined as,
+	// guarded by presenceMutex
+	presence          map[string]*presence
+	reconnectGraceSec atomic.Int64
+
+	// Tick of each player's last meaningful input and the players warned for
+	// being idle since, guarded by InputMutex
+	lastActive map[string]uint64
+	afkWarned  map[string]bool
+
+	// AFK thresholds, only used within Run
+	afkWarningSec int
+	afkTimeoutSec int
+	afkAction     AFKAction
+	joined        map[*common.Client]string
+	presenceMutex sync.Mutex
+
+	// Player limit, priority tokens and the clients waiting for a slot,
+	// guarded by presenceMutex
+	maxPlayers     int
+	priorityTokens map[string]bool
+	queue          []*queuedClient
+
+	// Display name rules, guarded by DisplayNamesMutex
+	nameMaxLength int
+	reservedNames map[string]bool
+
+	// Logger decorated with the room and current tick
+	logger *slog.Logger
+
+	// Name of the room this hub runs
+	room string
+
+	// Copy of CurrentTick that can be read without holding InputMutex
+	tick atomic.Uint64
 
 	// Tick interval in milliseconds
 	tickInterval int
@@ -85,92 +171,290 @@ type Hub struct {
 	// Maximum number of ticks to keep in history
 	maxHistorySize uint64
 
-	// Game session reset handling
-	resetTimer      *time.Timer
-	isResetting     bool
-	resetTimeoutSec int
+	// Drives processGameTick, stopped while the hub is suspended
+	ticker *time.Ticker
+
+	// Options from a reload that can only be applied between game sessions
+	pendingOptions *HubOptions
+
+	// Reloaded options waiting to be applied by Run
+	reconfigure chan HubOptions
+
+	// Announcement text sent to players
+	announcement      string
+	announcementMutex sync.Mutex
+
+	// Origins allowed to open WebSocket connections, replaced on reload
+	originPolicy atomic.Pointer[OriginPolicy]
+
+	// Proxies trusted to name the client, replaced on reload
+	proxyPolicy atomic.Pointer[ProxyPolicy]
+
+	// Connection limits for each client IP
+	ipLimiter *IPLimiter
+
+	// Banned player IDs and IPs
+	banList *bans.Store
+
+	// Bearer token of the admin API, replaced on reload
+	adminToken atomic.Pointer[string]
+
+	// Whether clients speaking the legacy protocol without a hello are refused
+	requireHello atomic.Bool
+
+	// Whether legacy clients may claim an online player's ID without its
+	// session token
+	legacySessions atomic.Bool
+
+	// Whether new connections negotiate permessage-deflate
+	compression atomic.Bool
+
+	// Clients to disconnect with a close code, see Disconnect
+	disconnect chan disconnectRequest
+
+	// Clients switching to the spectator role, see Spectate
+	spectate chan spectateRequest
+
+	// Signalled when players join or leave outside of Run, see playersChanged
+	joinedChanged chan struct{}
+
+	// Maximum number of spectators, zero for no limit
+	maxSpectators int
+
+	// Delayed spectator feed, the clients are protected by ClientsMutex and
+	// the queue of broadcasts waiting out the delay is owned by Run
+	delayedClients    map[*common.Client]bool
+	registerDelayed   chan *common.Client
+	delayedQueue      []delayedEntry
+	spectatorDelaySec atomic.Int64
+
+	// Phase of the match and the timer ending it, owned by Run, with the
+	// phase message kept for other goroutines
+	phase        types.MatchPhase
+	phaseTimer   *time.Timer
+	phaseMessage atomic.Pointer[types.PhaseMessage]
+
+	// Phase settings, only used within Run
+	minPlayers        int
+	waitingTimeoutSec int
+	startCountdownSec int
+	resetTimeoutSec   int
+	resetPauseSec     int
+
+	// Results history and player store, the time the running match started
+	// playing, owned by Run, and the result reports of the match that just
+	// ended, guarded by resultsMutex
+	matchList      *matches.Store
+	profileList    *profiles.Store
+	matchStartedAt time.Time
+	ballot         *ballot
+	resultsMutex   sync.Mutex
+
+	// Chat of the running match
+	chat *chat.Chat
+
+	// Counters exposed on the metrics endpoint
+	Metrics *Metrics
+
+	// Idle suspension handling, the match clock is stopped while no clients are connected
+	suspended  bool
+	idlePolicy IdlePolicy
+
+	// Whether the match clock is running
+	ticking bool
+
+	// Shutdown handling, Run stops when a reconnect hint arrives on shutdown
+	// and closes done once every client has been told to disconnect
+	shutdown chan int
+	done     chan struct{}
+
+	// Write pumps still running, so shutdown can wait for them to flush
+	pumps sync.WaitGroup
 }
 
-// NewHub creates a new Hub instance with default no-op logger and default options
+// NewHub creates a new Hub instance with a discarding logger and default options
 func NewHub() *Hub {
 	return NewHubWithOptions(HubOptions{
 		TickIntervalMs: DEFAULT_TICK_INTERVAL_MS,
 		MaxHistorySize: DEFAULT_MAX_HISTORY_SIZE,
-	}, common.NoopDebugLogger)
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
 }
 
-// NewHubWithDebug creates a new Hub instance with the provided debug logger and default options
-func NewHubWithDebug(debugLog common.DebugLoggerFunc) *Hub {
+// NewHubWithDebug creates a new Hub instance with the provided logger and default options
+func NewHubWithDebug(logger *slog.Logger) *Hub {
 	return NewHubWithOptions(HubOptions{
 		TickIntervalMs: DEFAULT_TICK_INTERVAL_MS,
 		MaxHistorySize: DEFAULT_MAX_HISTORY_SIZE,
-	}, debugLog)
+	}, logger)
 }
 
-// NewHubWithOptions creates a new Hub instance with the provided options and debug logger
-func NewHubWithOptions(options HubOptions, debugLog common.DebugLoggerFunc) *Hub {
+// NewHubWithOptions creates a new Hub instance with the provided options and logger
+func NewHubWithOptions(options HubOptions, logger *slog.Logger) *Hub {
 	// Set default reset timeout if not specified
 	resetTimeout := options.ResetTimeoutSec
 	if resetTimeout <= 0 {
 		resetTimeout = 30 // Default to 30 seconds
 	}
 
-	return &Hub{
+	// Keep abandoned matches by default
+	idlePolicy := options.IdlePolicy
+	if idlePolicy == "" {
+		idlePolicy = IdlePolicyKeep
+	}
+
+	room := options.Room
+	if room == "" {
+		room = DEFAULT_ROOM
+	}
+
+	// Without a ban file the bans only last until the server stops
+	banList := options.Bans
+	if banList == nil {
+		banList, _ = bans.Open("")
+	}
+
+	// Without a results file the results only last until the server stops
+	matchList := options.Matches
+	if matchList == nil {
+		matchList, _ = matches.Open("")
+	}
+
+	// Without a player file the profiles only last until the server stops
+	profileList := options.Profiles
+	if profileList == nil {
+		profileList, _ = profiles.Open("")
+	}
+
+	h := &Hub{
 		Clients:           make(map[*common.Client]bool),
 		ClientsMutex:      sync.Mutex{},
 		Register:          make(chan *common.Client),
 		Unregister:        make(chan *common.Client),
-		Broadcast:         make(chan common.ClientMessage, 1),
+		Broadcast:         make(chan common.ClientMessage, 64), // Room for chat and name updates alongside ticks
 		CurrentTick:       0,
 		CurrentInputs:     make([]types.PlayerInput, 0),
-		TickHistory:       make([]types.GameTick, 0, options.MaxHistorySize),
+		TickHistory:       make([]types.GameTick, 0, options.MaxHistorySize+1),
+		players:           wire.NewPlayerTable(),
 		DisplayNames:      make(map[string]string),
 		DisplayNamesMutex: sync.Mutex{},
-		debugLog:          debugLog,
+		room:              room,
 		tickInterval:      options.TickIntervalMs,
 		maxHistorySize:    options.MaxHistorySize,
 		resetTimeoutSec:   resetTimeout, // Use the provided or default reset timeout
-		isResetting:       false,
+		phase:             types.PhaseWaiting,
+		minPlayers:        max(options.MinPlayers, 1),
+		waitingTimeoutSec: options.WaitingTimeoutSec,
+		startCountdownSec: options.StartCountdownSec,
+		resetPauseSec:     options.ResetPauseSec,
+		Metrics:           NewMetrics(),
+		suspended:         true, // No clients are connected yet
+		idlePolicy:        idlePolicy,
+		reconfigure:       make(chan HubOptions),
+		disconnect:        make(chan disconnectRequest),
+		spectate:          make(chan spectateRequest),
+		joinedChanged:     make(chan struct{}, 1),
+		chat:              chat.New(options.Chat),
+		presence:          make(map[string]*presence),
+		joined:            make(map[*common.Client]string),
+		lastActive:        make(map[string]uint64),
+		afkWarned:         make(map[string]bool),
+		afkWarningSec:     options.AFKWarningSec,
+		afkTimeoutSec:     options.AFKTimeoutSec,
+		afkAction:         options.AFKAction,
+		nameMaxLength:     options.NameMaxLength,
+		reservedNames:     reservedNameKeys(options.ReservedNames),
+		maxSpectators:     options.MaxSpectators,
+		maxPlayers:        options.MaxPlayers,
+		priorityTokens:    tokenSet(options.PriorityTokens),
+		banList:           banList,
+		matchList:         matchList,
+		profileList:       profileList,
+		ipLimiter:         NewIPLimiter(options.MaxConnsPerIP, options.ConnsPerMinute),
+		delayedClients:    make(map[*common.Client]bool),
+		registerDelayed:   make(chan *common.Client),
+		announcement:      options.Announcement,
+		shutdown:          make(chan int),
+		done:              make(chan struct{}),
+	}
+
+	// Every hub log record carries the room and the tick it happened on
+	h.logger = slog.New(&tickHandler{Handler: logger.Handler(), tick: &h.tick}).With("room", room)
+
+	h.originPolicy.Store(NewOriginPolicy(options.AllowedOrigins, options.DevMode))
+	h.proxyPolicy.Store(NewProxyPolicy(options.TrustedProxies))
+	h.adminToken.Store(&options.AdminToken)
+	h.requireHello.Store(options.RequireHello)
+	h.legacySessions.Store(options.LegacySessions)
+	h.compression.Store(options.Compression)
+	h.spectatorDelaySec.Store(int64(options.SpectatorDelay))
+	h.reconnectGraceSec.Store(int64(options.ReconnectGrace))
+	h.CurrentEvents = []types.GameEvent{h.seedEvent()}
+	h.phaseMessage.Store(&types.PhaseMessage{Type: types.MessageTypePhase, Phase: h.phase, MinPlayers: h.minPlayers})
+	if options.DevMode {
+		h.logger.Warn("Dev mode enabled, accepting WebSocket connections from any origin")
 	}
+
+	return h
+}
+
+// ClientLogger returns a logger that tags records with the given client ID
+func (h *Hub) ClientLogger(clientID string) *slog.Logger {
+	return h.logger.With("client", clientID)
 }
 
 // Run starts the hub, processing client connections and game ticks
 func (h *Hub) Run() {
-	// Start the game tick timer with the configured interval
-	ticker := time.NewTicker(time.Duration(h.tickInterval) * time.Millisecond)
-	defer ticker.Stop()
+	// Create the game tick timer with the configured interval, it stays
+	// stopped while the hub is suspended waiting for the first client
+	h.ticker = time.NewTicker(time.Duration(h.tickInterval) * time.Millisecond)
+	defer h.ticker.Stop()
+	h.ticker.Stop()
+
+	// Release broadcasts to the delayed spectator feed as they come of age
+	releaseTicker := time.NewTicker(delayedReleaseInterval)
+	defer releaseTicker.Stop()
 
-	// Create a nil channel for the reset timer
-	var resetChan <-chan time.Time
+	// Look for idle players
+	afkTicker := time.NewTicker(afkCheckInterval)
+	defer afkTicker.Stop()
 
-	h.debugLog("Hub started, running at %dms per tick", h.tickInterval)
+	// Create a nil channel for the phase timer
+	var phaseChan <-chan time.Time
+
+	h.logger.Debug("Hub started", "tickIntervalMs", h.tickInterval)
 
 	for {
 		select {
 		case client := <-h.Register:
 			h.ClientsMutex.Lock()
+			_, spectatorCount := h.countRoles()
+			if client.Spectator.Load() && h.maxSpectators > 0 && spectatorCount >= h.maxSpectators {
+				h.ClientsMutex.Unlock()
+				h.refuseSpectator(client)
+				break
+			}
 			h.Clients[client] = true
-			clientCount := len(h.Clients)
+			playerCount, spectatorCount := h.countRoles()
 			h.ClientsMutex.Unlock()
 
-			log.Printf("Client connected: %s (total: %d)", client.ID, clientCount)
-			h.debugLog("Client %s connected from, total clients: %d", client.ID, clientCount)
+			client.Logger().Info("Client connected",
+				"spectator", client.Spectator.Load(), "players", playerCount, "spectators", spectatorCount)
 
 			// Send connection message with game session information
-			connectMsg := types.ConnectMessage{
-				Type:         types.MessageTypeConnect,
-				PlayerID:     client.ID, // This is initially a temporary ID
-				MaxTicks:     h.maxHistorySize,
-				TickInterval: h.tickInterval,
-			}
+			// The client ID is initially a temporary ID
+			connectMsg := h.newConnectMessage(client)
 
 			select {
 			case client.SendChan <- connectMsg:
-				h.debugLog("Connect message sent to client %s", client.ID)
+				client.Logger().Debug("Connect message sent")
 			default:
-				h.debugLog("Failed to send connect message to client %s", client.ID)
+				client.Logger().Warn("Failed to send connect message")
 			}
 
+			// Spectators alone don't start the match
+			h.playersChanged()
+			h.SendPhaseToClient(client)
+
 			// We won't send history yet - we'll wait for the client to send their ID first
 			// The client handler will send history after receiving the client ID
 
@@ -179,12 +463,36 @@ func (h *Hub) Run() {
 			if _, ok := h.Clients[client]; ok {
 				delete(h.Clients, client)
 				close(client.SendChan)
-				clientCount := len(h.Clients)
-				log.Printf("Client disconnected: %s (total: %d)", client.ID, clientCount)
-				h.debugLog("Client %s disconnected, total clients: %d", client.ID, clientCount)
+				playerCount, spectatorCount := h.countRoles()
+				client.Logger().Info("Client disconnected", "players", playerCount, "spectators", spectatorCount)
+			} else if h.delayedClients[client] {
+				delete(h.delayedClients, client)
+				close(client.SendChan)
+				client.Logger().Info("Delayed spectator disconnected", "delayedSpectators", len(h.delayedClients))
 			}
 			h.ClientsMutex.Unlock()
 
+			h.leave(client)
+			h.playersChanged()
+
+		case request := <-h.disconnect:
+			h.disconnectClient(request.client, request.closeCode, request.reason)
+
+		case <-h.joinedChanged:
+			h.playersChanged()
+
+		case request := <-h.spectate:
+			request.result <- h.makeSpectator(request.client)
+
+		case client := <-h.registerDelayed:
+			h.addDelayedClient(client)
+
+		case <-releaseTicker.C:
+			h.releaseDelayed()
+
+		case <-afkTicker.C:
+			h.checkAFK()
+
 		case message := <-h.Broadcast:
 			h.ClientsMutex.Lock()
 
@@ -196,16 +504,25 @@ func (h *Hub) Run() {
 
 			h.ClientsMutex.Unlock()
 
+			h.queueDelayed(message)
+
+			// Encode the message once for every client
+			if len(clients) > 0 {
+				message = h.prepare(message)
+			}
+
 			recipientCount := 0
 			clientsToRemove := make([]*common.Client, 0)
 
 			// Send to all clients
 			for client := range clients {
+				h.Metrics.SendQueueDepth.Observe(float64(len(client.SendChan)))
 				select {
 				case client.SendChan <- message:
 					recipientCount++
 				default:
-					h.debugLog("Failed to send message to client %s, marking for removal", client.ID)
+					h.Metrics.ClientBroadcastDrops.Add(1)
+					client.Logger().Warn("Send queue full, marking client for removal", "type", message.GetType())
 					clientsToRemove = append(clientsToRemove, client)
 				}
 			}
@@ -220,68 +537,207 @@ func (h *Hub) Run() {
 					}
 				}
 				h.ClientsMutex.Unlock()
+
+				h.playersChanged()
 			}
 
-			h.debugLog("Broadcast message of type %s to %d clients", message.GetType(), recipientCount)
+			h.logger.Debug("Broadcast message", "type", message.GetType(), "recipients", recipientCount)
 
-		case <-ticker.C:
+		case <-h.ticker.C:
 			// Process game tick
 			h.processGameTick()
 
-		case <-resetChan:
-			// Reset the game session
-			h.resetGameSession()
-			// Clear the channel
-			resetChan = nil
+		case <-phaseChan:
+			// Move on from a phase whose time is up
+			h.endPhase()
+
+		case options := <-h.reconfigure:
+			h.applyOptions(options)
+			h.RecordEvent(types.GameEvent{Kind: types.EventAdmin, Value: AdminActionReload})
+
+		case reconnectAfterSec := <-h.shutdown:
+			h.disconnectAll(reconnectAfterSec)
+			if h.phaseTimer != nil {
+				h.phaseTimer.Stop()
+			}
+			close(h.done)
+			h.logger.Info("Hub stopped")
+			return
 		}
 
-		// Update resetChan if timer is created but channel isn't set
-		if h.resetTimer != nil && resetChan == nil {
-			resetChan = h.resetTimer.C
+		// Track the current phase timer, which may have been replaced or cleared
+		if h.phaseTimer != nil {
+			phaseChan = h.phaseTimer.C
+		} else {
+			phaseChan = nil
 		}
 	}
 }
 
+// Shutdown stops the hub, telling every client to reconnect after the given
+// number of seconds, and waits until their connections have been closed
+func (h *Hub) Shutdown(ctx context.Context, reconnectAfterSec int) error {
+	select {
+	case h.shutdown <- reconnectAfterSec:
+	case <-h.done:
+		// Already shut down
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Wait for the write pumps to flush the shutdown message and close frames
+	flushed := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// disconnectRequest asks Run to close a client's connection
+type disconnectRequest struct {
+	client    *common.Client
+	closeCode int
+	reason    string
+}
+
+// Disconnect closes a client's connection with the given WebSocket close
+// code and reason, once the messages already queued for it have been written
+func (h *Hub) Disconnect(client *common.Client, closeCode int, reason string) {
+	select {
+	case h.disconnect <- disconnectRequest{client: client, closeCode: closeCode, reason: reason}:
+	case <-h.done:
+	}
+}
+
+// disconnectClient closes a client's connection with the given close code
+// and reason, from within Run
+func (h *Hub) disconnectClient(client *common.Client, closeCode int, reason string) {
+	h.ClientsMutex.Lock()
+	_, live := h.Clients[client]
+	if live || h.delayedClients[client] {
+		delete(h.Clients, client)
+		delete(h.delayedClients, client)
+
+		// The write pump sends the close frame once the queue has drained
+		client.CloseCode = closeCode
+		client.CloseReason = reason
+		close(client.SendChan)
+		playerCount, spectatorCount := h.countRoles()
+		client.Logger().Info("Client disconnected by server",
+			"reason", reason, "players", playerCount, "spectators", spectatorCount)
+	}
+	h.ClientsMutex.Unlock()
+
+	h.leave(client)
+	h.playersChanged()
+}
+
+// disconnectAll sends the shutdown message to every client and closes their connections
+func (h *Hub) disconnectAll(reconnectAfterSec int) {
+	shutdownMsg := types.ServerShutdownMessage{
+		Type:              types.MessageTypeShutdown,
+		Reason:            "Server is shutting down",
+		ReconnectAfterSec: reconnectAfterSec,
+	}
+
+	h.ClientsMutex.Lock()
+	defer h.ClientsMutex.Unlock()
+
+	h.logger.Info("Disconnecting all clients",
+		"clients", len(h.Clients), "delayedSpectators", len(h.delayedClients), "reconnectAfterSec", reconnectAfterSec)
+
+	for _, clients := range []map[*common.Client]bool{h.Clients, h.delayedClients} {
+		for client := range clients {
+			select {
+			case client.SendChan <- shutdownMsg:
+				client.Logger().Debug("Shutdown message sent")
+			default:
+				client.Logger().Warn("Failed to send shutdown message")
+			}
+
+			// The write pump sends the close frame once the queue has drained
+			client.CloseCode = websocket.CloseGoingAway
+			client.CloseReason = "server shutting down"
+			close(client.SendChan)
+			delete(clients, client)
+		}
+	}
+}
+
+// suspend stops the match clock once the last player has left
+func (h *Hub) suspend() {
+	h.suspended = true
+	h.updateClock()
+
+	h.logger.Info("No players connected, suspending match", "idlePolicy", h.idlePolicy)
+
+	if h.idlePolicy == IdlePolicyReset && (h.phase == types.PhasePlaying || h.phase == types.PhaseResults) {
+		h.resetGameSession()
+		h.wait()
+	}
+}
+
+// resume restarts the match clock when a player joins a suspended hub
+func (h *Hub) resume() {
+	h.suspended = false
+	h.updateClock()
+
+	h.logger.Info("Player connected, resuming match")
+}
+
 // sendHistoryToClient sends the game history to a newly connected client
 func (h *Hub) sendHistoryToClient(client *common.Client) {
+	h.sendHistoryUntil(client, math.MaxUint64)
+}
+
+// sendHistoryUntil sends the ticks of the game history before untilTick to a client
+func (h *Hub) sendHistoryUntil(client *common.Client, untilTick uint64) {
 	h.InputMutex.Lock()
 	defer h.InputMutex.Unlock()
 
-	historyLength := len(h.TickHistory)
+	history := h.TickHistory
+	historyLength := sort.Search(len(history), func(i int) bool {
+		return history[i].Tick >= untilTick
+	})
 	if historyLength == 0 {
-		h.debugLog("No history to send to client %s", client.ID)
+		client.Logger().Debug("No history to send")
 		return
 	}
 
 	// Create a history sync message
 	historyMsg := types.HistorySyncMessage{
 		Type:     types.MessageTypeHistorySync,
-		History:  h.TickHistory,
-		FromTick: h.TickHistory[0].Tick,
-		ToTick:   h.TickHistory[historyLength-1].Tick,
+		History:  history[:historyLength],
+		FromTick: history[0].Tick,
+		ToTick:   history[historyLength-1].Tick,
 	}
 
-	h.debugLog("Sending history to client %s (ticks %d to %d, %d total ticks)",
-		client.ID, historyMsg.FromTick, historyMsg.ToTick, historyLength)
+	client.Logger().Debug("Sending history",
+		"fromTick", historyMsg.FromTick, "toTick", historyMsg.ToTick, "ticks", historyLength)
 
 	// Send the message directly
 	select {
 	case client.SendChan <- historyMsg:
-		h.debugLog("History message sent to client %s", client.ID)
+		client.Logger().Debug("History message sent")
 	default:
-		h.debugLog("Failed to send history message to client %s", client.ID)
+		client.Logger().Warn("Failed to send history message")
 	}
 }
 
 // processGameTick creates a new game tick message and broadcasts it to all clients
 func (h *Hub) processGameTick() {
+	start := time.Now()
 	h.InputMutex.Lock()
 
-	// Check if we need to start reset countdown when game is over
-	// Game is over when we reach max ticks
-	if !h.isResetting && h.CurrentTick > 0 && h.CurrentTick >= h.maxHistorySize {
-		h.startResetCountdown()
-	}
+	// Game is over once the tick reaching max ticks has been sent
+	gameOver := h.CurrentTick > 0 && h.CurrentTick >= h.maxHistorySize
 
 	inputCount := len(h.CurrentInputs)
 
@@ -291,73 +747,86 @@ func (h *Hub) processGameTick() {
 		Tick: types.GameTick{
 			Tick:   h.CurrentTick,
 			Inputs: h.CurrentInputs,
+			Events: h.CurrentEvents,
 		},
 	}
 
 	// Debug log inputs for this tick
-	if inputCount > 0 {
-		h.debugLog("Tick %d: Processing %d inputs", h.CurrentTick, inputCount)
+	if h.logger.Enabled(context.Background(), slog.LevelDebug) {
+		h.logger.Debug("Processing tick", "inputs", inputCount)
 		for i, input := range h.CurrentInputs {
 			inputJson, _ := json.Marshal(input)
-			h.debugLog("  Input %d: %s", i, string(inputJson))
+			h.logger.Debug("Tick input", "index", i, "input", string(inputJson))
 		}
-	} else {
-		h.debugLog("Tick %d: No inputs to process", h.CurrentTick)
 	}
 
-	// Add the current tick to history
-	if uint64(len(h.TickHistory)) >= h.maxHistorySize {
+	// Add the current tick to history, which holds every tick of the match
+	// so the seed in tick 0 is never dropped
+	if uint64(len(h.TickHistory)) >= h.historyCapacity() {
 		// If history is full, remove the oldest tick
 		h.TickHistory = h.TickHistory[1:]
 	}
 	h.TickHistory = append(h.TickHistory, tickMessage.Tick)
 
-	// Reset inputs for the next tick
+	// Encode the tick once for every client that negotiated binary frames
+	frame := tickFrame{TickMessage: tickMessage, frame: wire.EncodeTick(nil, tickMessage.Tick, h.players)}
+
+	// Reset inputs and events for the next tick
 	h.CurrentInputs = make([]types.PlayerInput, 0)
+	h.CurrentEvents = nil
 	h.CurrentTick++
+	h.tick.Store(h.CurrentTick)
 	h.InputMutex.Unlock()
 
 	// Broadcast the tick message directly
 	select {
-	case h.Broadcast <- tickMessage:
+	case h.Broadcast <- frame:
 	default:
-		h.debugLog("Failed to send message to broadcast channel")
+		h.Metrics.HubBroadcastDrops.Add(1)
+		h.logger.Warn("Failed to send tick to broadcast channel")
 	}
-}
 
-// startResetCountdown begins the countdown to reset the game session
-func (h *Hub) startResetCountdown() {
-	h.isResetting = true
-	h.debugLog("Starting reset countdown (%d seconds)", h.resetTimeoutSec)
+	h.Metrics.observeTick(start, time.Duration(h.tickInterval)*time.Millisecond, inputCount)
 
-	// Stop any existing timer first
-	if h.resetTimer != nil {
-		h.resetTimer.Stop()
+	if gameOver {
+		h.startResetCountdown()
 	}
+}
+
+// historyCapacity is the number of ticks in a match, from tick 0 up to and
+// including the tick reaching max ticks
+func (h *Hub) historyCapacity() uint64 {
+	return h.maxHistorySize + 1
+}
 
-	// Create reset timer
-	h.resetTimer = time.NewTimer(time.Duration(h.resetTimeoutSec) * time.Second)
+// startResetCountdown shows the results of the match until the game session
+// is reset
+func (h *Hub) startResetCountdown() {
+	h.logger.Info("Starting reset countdown", "resetTimeoutSec", h.resetTimeoutSec)
+	h.setPhase(types.PhaseResults, time.Duration(h.resetTimeoutSec)*time.Second)
+	h.openBallot()
 
 	// Start sending countdown messages
-	go h.broadcastCountdown()
+	go h.broadcastCountdown(h.resetTimeoutSec)
 }
 
 // broadcastCountdown sends countdown updates to all clients
-func (h *Hub) broadcastCountdown() {
+func (h *Hub) broadcastCountdown(resetTimeoutSec int) {
 	// Send countdown messages every second
-	for countdown := h.resetTimeoutSec; countdown >= 0; countdown-- {
+	for countdown := resetTimeoutSec; countdown >= 0; countdown-- {
 		resetMsg := types.ResetMessage{
 			Type:         types.MessageTypeReset,
-			ResetTimeSec: h.resetTimeoutSec,
+			ResetTimeSec: resetTimeoutSec,
 			CountdownSec: countdown,
 		}
 
 		// Broadcast countdown message
 		select {
 		case h.Broadcast <- resetMsg:
-			h.debugLog("Broadcast reset countdown: %d seconds remaining", countdown)
+			h.logger.Debug("Broadcast reset countdown", "countdownSec", countdown)
 		default:
-			h.debugLog("Failed to broadcast countdown message")
+			h.Metrics.HubBroadcastDrops.Add(1)
+			h.logger.Warn("Failed to broadcast countdown message")
 		}
 
 		// Wait 1 second between updates
@@ -369,22 +838,40 @@ func (h *Hub) broadcastCountdown() {
 
 // resetGameSession resets the game to start a new session
 func (h *Hub) resetGameSession() {
+	// Record the result of the match that ended, if it hasn't been yet
+	h.closeBallot()
+
 	h.InputMutex.Lock()
-	defer h.InputMutex.Unlock()
 
-	h.debugLog("Resetting game session")
+	h.logger.Info("Resetting game session")
+	h.Metrics.ResetsTotal.Add(1)
+
+	// Apply reloaded settings that were waiting for the match to end
+	if h.pendingOptions != nil {
+		h.tickInterval = h.pendingOptions.TickIntervalMs
+		h.maxHistorySize = h.pendingOptions.MaxHistorySize
+		h.pendingOptions = nil
+		h.logger.Info("Applied queued game settings",
+			"tickIntervalMs", h.tickInterval, "maxTicks", h.maxHistorySize)
+	}
+
+	// Delayed spectators see the new session once they reach it
+	h.queueDelayed(nil)
 
 	// Reset game state
 	h.CurrentTick = 0
+	h.tick.Store(0)
 	h.CurrentInputs = make([]types.PlayerInput, 0)
-	h.TickHistory = make([]types.GameTick, 0, h.maxHistorySize)
-	h.isResetting = false
+	h.CurrentEvents = []types.GameEvent{h.seedEvent()}
+	h.lastActive = make(map[string]uint64)
+	h.afkWarned = make(map[string]bool)
+	h.TickHistory = make([]types.GameTick, 0, h.historyCapacity())
+	h.players = wire.NewPlayerTable()
+	h.chat.Reset()
 
-	// Clean up the reset timer to avoid issues with subsequent resets
-	if h.resetTimer != nil {
-		h.resetTimer.Stop()
-		h.resetTimer = nil
-	}
+	h.InputMutex.Unlock()
+
+	h.restartPresence()
 
 	// Get a copy of the clients to broadcast to
 	h.ClientsMutex.Lock()
@@ -397,38 +884,260 @@ func (h *Hub) resetGameSession() {
 	// Broadcast a new connect message to all clients to reset their states
 	for _, client := range clients {
 		// Send updated connection message with game session information
-		connectMsg := types.ConnectMessage{
-			Type:         types.MessageTypeConnect,
-			PlayerID:     client.ID,
-			MaxTicks:     h.maxHistorySize,
-			TickInterval: h.tickInterval,
-		}
+		connectMsg := h.newConnectMessage(client)
 
 		select {
 		case client.SendChan <- connectMsg:
-			h.debugLog("Reset message sent to client %s", client.ID)
+			client.Logger().Debug("Reset message sent")
 		default:
-			h.debugLog("Failed to send reset message to client %s", client.ID)
+			client.Logger().Warn("Failed to send reset message")
+		}
+
+		// The empty player table tells binary clients the indexes start over
+		if client.HasCapability(CapabilityBinary) {
+			h.sendPlayerTable(client)
 		}
 	}
 }
 
-// AddInput adds a player input to the current tick
+// newConnectMessage creates the connect message describing the current game
+// session to a client
+func (h *Hub) newConnectMessage(client *common.Client) types.ConnectMessage {
+	h.InputMutex.Lock()
+	defer h.InputMutex.Unlock()
+
+	connectMsg := types.ConnectMessage{
+		Type:         types.MessageTypeConnect,
+		PlayerID:     client.ID,
+		MaxTicks:     h.maxHistorySize,
+		TickInterval: h.tickInterval,
+		Spectator:    client.Spectator.Load(),
+	}
+	if !connectMsg.Spectator {
+		connectMsg.Rating = h.rating(client.ID)
+	}
+	return connectMsg
+}
+
+// welcome sends a client that took a player ID the connect message with
+// its session token, followed by everything it needs to catch up with the
+// match
+func (h *Hub) welcome(client *common.Client, playerID string, sessionToken string) {
+	connectMsg := h.newConnectMessage(client)
+	connectMsg.PlayerID = playerID
+	connectMsg.SessionToken = sessionToken
+	if !connectMsg.Spectator {
+		connectMsg.Rating = h.rating(playerID)
+	}
+
+	select {
+	case client.SendChan <- connectMsg:
+		client.Logger().Debug("Connect message sent after ID update")
+	default:
+		client.Logger().Warn("Failed to send connect message after ID update")
+	}
+
+	// Send history to the client again
+	h.sendHistoryToClient(client)
+
+	// Send current display names to the client
+	h.SendDisplayNamesToClient(client)
+
+	// Send the announcement, if there is one
+	h.SendAnnouncementToClient(client)
+
+	// Catch the client up with the chat
+	h.SendChatHistoryToClient(client)
+
+	// Tell the client where the match is at
+	h.SendPhaseToClient(client)
+}
+
+// Reconfigure applies reloaded options to the running hub
+//
+// The phase settings, reset timeout, idle policy, announcement, allowed
+// origins, hello requirement, trusted proxies, connection limits, admin
+// token, compression, spectator limit, spectator delay, reconnect grace
+// period, player limit, priority tokens, display name rules and chat settings
+// take effect immediately, compression and the spectator limit only for new
+// connections.
+// A changed tick interval or match length would break the running match, so
+// those are queued until the next game session starts. The room can't be
+// changed without a restart.
+func (h *Hub) Reconfigure(options HubOptions) {
+	select {
+	case h.reconfigure <- options:
+	case <-h.done:
+	}
+}
+
+// applyOptions applies reloaded options from within Run
+func (h *Hub) applyOptions(options HubOptions) {
+	if options.ResetTimeoutSec > 0 && options.ResetTimeoutSec != h.resetTimeoutSec {
+		h.resetTimeoutSec = options.ResetTimeoutSec
+		h.logger.Info("Updated reset timeout", "resetTimeoutSec", h.resetTimeoutSec)
+	}
+
+	if max(options.MinPlayers, 1) != h.minPlayers || options.WaitingTimeoutSec != h.waitingTimeoutSec ||
+		options.StartCountdownSec != h.startCountdownSec || options.ResetPauseSec != h.resetPauseSec {
+		h.minPlayers = max(options.MinPlayers, 1)
+		h.waitingTimeoutSec = options.WaitingTimeoutSec
+		h.startCountdownSec = options.StartCountdownSec
+		h.resetPauseSec = options.ResetPauseSec
+		h.logger.Info("Updated match phases", "minPlayers", h.minPlayers, "waitingTimeoutSec", h.waitingTimeoutSec,
+			"startCountdownSec", h.startCountdownSec, "resetPauseSec", h.resetPauseSec)
+	}
+
+	if options.IdlePolicy != "" && options.IdlePolicy != h.idlePolicy {
+		h.idlePolicy = options.IdlePolicy
+		h.logger.Info("Updated idle policy", "idlePolicy", h.idlePolicy)
+	}
+
+	h.setAnnouncement(options.Announcement)
+
+	h.originPolicy.Store(NewOriginPolicy(options.AllowedOrigins, options.DevMode))
+
+	h.proxyPolicy.Store(NewProxyPolicy(options.TrustedProxies))
+
+	h.ipLimiter.Reconfigure(options.MaxConnsPerIP, options.ConnsPerMinute)
+
+	h.adminToken.Store(&options.AdminToken)
+
+	if h.requireHello.Swap(options.RequireHello) != options.RequireHello {
+		h.logger.Info("Updated protocol requirements", "requireHello", options.RequireHello)
+	}
+	if h.legacySessions.Swap(options.LegacySessions) != options.LegacySessions {
+		h.logger.Info("Updated session requirements", "legacySessions", options.LegacySessions)
+	}
+
+	if h.compression.Swap(options.Compression) != options.Compression {
+		h.logger.Info("Updated compression for new connections", "compression", options.Compression)
+	}
+
+	if int64(options.SpectatorDelay) != h.spectatorDelaySec.Swap(int64(options.SpectatorDelay)) {
+		h.logger.Info("Updated spectator delay", "spectatorDelaySec", options.SpectatorDelay)
+	}
+
+	if int64(options.ReconnectGrace) != h.reconnectGraceSec.Swap(int64(options.ReconnectGrace)) {
+		h.logger.Info("Updated reconnect grace period", "reconnectGraceSec", options.ReconnectGrace)
+	}
+
+	if options.AFKWarningSec != h.afkWarningSec || options.AFKTimeoutSec != h.afkTimeoutSec || options.AFKAction != h.afkAction {
+		h.afkWarningSec = options.AFKWarningSec
+		h.afkTimeoutSec = options.AFKTimeoutSec
+		h.afkAction = options.AFKAction
+		h.logger.Info("Updated AFK thresholds",
+			"afkWarningSec", h.afkWarningSec, "afkTimeoutSec", h.afkTimeoutSec, "afkAction", h.afkAction)
+	}
+
+	h.setNameRules(options.NameMaxLength, options.ReservedNames)
+
+	h.setCapacity(options.MaxPlayers, options.PriorityTokens)
+
+	h.chat.Reconfigure(options.Chat)
+
+	if options.MaxSpectators != h.maxSpectators {
+		h.maxSpectators = options.MaxSpectators
+		h.logger.Info("Updated spectator limit", "maxSpectators", h.maxSpectators)
+	}
+
+	h.InputMutex.Lock()
+	matchChanged := options.TickIntervalMs != h.tickInterval || options.MaxHistorySize != h.maxHistorySize
+	h.InputMutex.Unlock()
+
+	if matchChanged {
+		h.pendingOptions = &options
+		h.logger.Info("Queued game settings until the next game session",
+			"tickIntervalMs", options.TickIntervalMs, "maxTicks", options.MaxHistorySize)
+	} else if h.pendingOptions != nil {
+		h.pendingOptions = nil
+		h.logger.Info("Discarded queued game settings, they match the running session")
+	}
+}
+
+// AddInput adds a player input to the current tick, inputs sent outside of
+// the playing phase are dropped
 func (h *Hub) AddInput(input types.PlayerInput) {
+	if h.Phase() != types.PhasePlaying {
+		return
+	}
+
 	h.InputMutex.Lock()
 	defer h.InputMutex.Unlock()
 	h.CurrentInputs = append(h.CurrentInputs, input)
+	h.markActive(input)
 }
 
-// UpdateDisplayName updates a player's display name and broadcasts it to all clients
-func (h *Hub) UpdateDisplayName(playerID string, displayName string) {
+// UpdateDisplayName normalizes a player's display name and broadcasts it to
+// all clients, refusing names that are invalid, reserved or already taken by
+// another player in the room
+//
+// Names of players who left are kept for the match history, but are free
+// for anyone else to take.
+func (h *Hub) UpdateDisplayName(playerID string, displayName string) error {
+	h.presenceMutex.Lock()
 	h.DisplayNamesMutex.Lock()
+	unlock := func() {
+		h.DisplayNamesMutex.Unlock()
+		h.presenceMutex.Unlock()
+	}
+
+	displayName, err := names.Normalize(displayName, h.nameMaxLength)
+	if err != nil {
+		unlock()
+		return err
+	}
+
+	key := names.Key(displayName)
+	if h.reservedNames[key] {
+		unlock()
+		return names.ErrReserved
+	}
+	for id, name := range h.DisplayNames {
+		if p, online := h.presence[id]; online && p.active() && id != playerID && names.Key(name) == key {
+			unlock()
+			return names.ErrTaken
+		}
+	}
+
+	changed := h.DisplayNames[playerID] != displayName
 	h.DisplayNames[playerID] = displayName
-	h.DisplayNamesMutex.Unlock()
-	h.debugLog("Updated display name for player %s: %s", playerID, displayName)
+	unlock()
+	h.ClientLogger(playerID).Debug("Updated display name", "displayName", displayName)
+
+	if changed {
+		h.RecordEvent(types.GameEvent{Kind: types.EventNameChange, PlayerID: playerID, Value: displayName})
+	}
 
 	// Broadcast updated display names to all clients
 	h.broadcastDisplayNames()
+	return nil
+}
+
+// setNameRules applies the display name length limit and reserved names,
+// names already picked are kept
+func (h *Hub) setNameRules(maxLength int, reserved []string) {
+	reservedNames := reservedNameKeys(reserved)
+
+	h.DisplayNamesMutex.Lock()
+	defer h.DisplayNamesMutex.Unlock()
+
+	if maxLength != h.nameMaxLength || len(reservedNames) != len(h.reservedNames) {
+		h.logger.Info("Updated display name rules", "nameMaxLength", maxLength, "reservedNames", len(reservedNames))
+	}
+	h.nameMaxLength = maxLength
+	h.reservedNames = reservedNames
+}
+
+// reservedNameKeys returns the set of comparison keys of the reserved names
+func reservedNameKeys(reserved []string) map[string]bool {
+	keys := make(map[string]bool, len(reserved))
+	for _, name := range reserved {
+		if name, err := names.Normalize(name, 0); err == nil {
+			keys[names.Key(name)] = true
+		}
+	}
+	return keys
 }
 
 // broadcastDisplayNames broadcasts the current display names to all clients
@@ -453,9 +1162,10 @@ func (h *Hub) broadcastDisplayNames() {
 	// Broadcast the message
 	select {
 	case h.Broadcast <- displayNameMsg:
-		h.debugLog("Broadcast display names update to clients")
+		h.logger.Debug("Broadcast display names update")
 	default:
-		h.debugLog("Failed to broadcast display names update")
+		h.Metrics.HubBroadcastDrops.Add(1)
+		h.logger.Warn("Failed to broadcast display names update")
 	}
 }
 
@@ -486,22 +1196,71 @@ func (h *Hub) SendDisplayNamesToClient(client *common.Client) {
 	// Send the message directly to the client
 	select {
 	case client.SendChan <- displayNameMsg:
-		h.debugLog("Sent display names to client %s", client.ID)
+		client.Logger().Debug("Sent display names")
+	default:
+		client.Logger().Warn("Failed to send display names")
+	}
+}
+
+// setAnnouncement changes the announcement text and broadcasts it if it changed
+func (h *Hub) setAnnouncement(text string) {
+	h.announcementMutex.Lock()
+	changed := text != h.announcement
+	h.announcement = text
+	h.announcementMutex.Unlock()
+
+	if !changed {
+		return
+	}
+
+	h.logger.Info("Updated announcement", "announcement", text)
+
+	select {
+	case h.Broadcast <- types.AnnouncementMessage{Type: types.MessageTypeAnnounce, Text: text}:
+	default:
+		h.Metrics.HubBroadcastDrops.Add(1)
+		h.logger.Warn("Failed to broadcast announcement")
+	}
+}
+
+// SendAnnouncementToClient sends the current announcement, if any, to a single client
+func (h *Hub) SendAnnouncementToClient(client *common.Client) {
+	h.announcementMutex.Lock()
+	text := h.announcement
+	h.announcementMutex.Unlock()
+
+	if text == "" {
+		return
+	}
+
+	select {
+	case client.SendChan <- types.AnnouncementMessage{Type: types.MessageTypeAnnounce, Text: text}:
+		client.Logger().Debug("Sent announcement")
+	default:
+		client.Logger().Warn("Failed to send announcement")
+	}
+}
+
+// sendError tells a client that a message it sent was refused
+func (h *Hub) sendError(client *common.Client, code string, message string) {
+	select {
+	case client.SendChan <- types.ErrorMessage{Type: types.MessageTypeError, Code: code, Message: message}:
+		client.Logger().Debug("Sent error", "code", code)
 	default:
-		h.debugLog("Failed to send display names to client %s", client.ID)
+		client.Logger().Warn("Failed to send error", "code", code)
 	}
 }
 
 // UpdateClientId updates a client's ID and transfers any associated data
 func (h *Hub) UpdateClientId(oldId string, newId string) {
-	h.debugLog("Updating client ID in hub: %s -> %s", oldId, newId)
+	h.ClientLogger(newId).Debug("Updating client ID in hub", "oldClient", oldId)
 
 	// Transfer display name if it exists
 	h.DisplayNamesMutex.Lock()
 	if displayName, exists := h.DisplayNames[oldId]; exists {
 		h.DisplayNames[newId] = displayName
 		delete(h.DisplayNames, oldId)
-		h.debugLog("Transferred display name for %s to %s", oldId, newId)
+		h.ClientLogger(newId).Debug("Transferred display name", "oldClient", oldId)
 	}
 	h.DisplayNamesMutex.Unlock()
 
@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/gorilla/websocket"
+)
+
+// startTestHub runs a hub behind a test server, stopping both when the test ends
+func startTestHub(t *testing.T, options HubOptions) (*Hub, string) {
+	t.Helper()
+
+	hub := NewHubWithOptions(options, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(hub, w, r)
+	}))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hub.Shutdown(ctx, 0)
+		server.Close()
+	})
+
+	return hub, "ws" + server.URL[len("http"):]
+}
+
+// joinTestPlayer connects a client that joins as a player, reading and
+// discarding everything the hub sends it
+func joinTestPlayer(t *testing.T, url string, playerID string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("error connecting client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(types.ClientIdMessage{Type: types.MessageTypeClientId, PlayerID: playerID}); err != nil {
+		t.Fatalf("error joining as %s: %v", playerID, err)
+	}
+	return conn
+}
+
+// waitForPhase waits until the match reaches a phase
+func waitForPhase(t *testing.T, hub *Hub, phase types.MatchPhase) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for hub.Phase() != phase {
+		if time.Now().After(deadline) {
+			t.Fatalf("match is in phase %s, want %s", hub.Phase(), phase)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHistoryKeepsSeedForWholeMatch(t *testing.T) {
+	const maxTicks = 40
+
+	hub, url := startTestHub(t, HubOptions{
+		TickIntervalMs:  1,
+		MaxHistorySize:  maxTicks,
+		MinPlayers:      1,
+		ResetTimeoutSec: 60,
+	})
+	joinTestPlayer(t, url, "player1")
+	waitForPhase(t, hub, types.PhaseResults)
+
+	hub.InputMutex.Lock()
+	defer hub.InputMutex.Unlock()
+
+	history := hub.TickHistory
+	if len(history) != maxTicks+1 {
+		t.Fatalf("history has %d ticks, want every tick from 0 to %d", len(history), maxTicks)
+	}
+	if history[0].Tick != 0 || history[len(history)-1].Tick != maxTicks {
+		t.Errorf("history runs from tick %d to %d, want 0 to %d", history[0].Tick, history[len(history)-1].Tick, maxTicks)
+	}
+
+	seeded := false
+	for _, event := range history[0].Events {
+		if event.Kind == types.EventSeed && event.Value != "" {
+			seeded = true
+		}
+	}
+	if !seeded {
+		t.Errorf("tick 0 has no seed event, events are %+v", history[0].Events)
+	}
+}
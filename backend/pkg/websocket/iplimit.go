@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// How often the IP limiter forgets addresses without connections whose
+// connection rate has fully recovered
+const ipSweepInterval = time.Minute
+
+// IPLimiter caps the number of concurrent connections and the rate of new
+// connections from each client IP address
+//
+// The connection rate is a token bucket holding a minute's worth of
+// connections, so a client can reconnect in a burst but not keep doing so.
+type IPLimiter struct {
+	mutex          sync.Mutex
+	maxConnections int     // Concurrent connections per address, zero for no limit
+	perMinute      float64 // New connections per address per minute, zero for no limit
+	addresses      map[string]*ipEntry
+	lastSweep      time.Time
+}
+
+// ipEntry tracks the connections from a single address
+type ipEntry struct {
+	connections int
+	tokens      float64
+	updated     time.Time
+}
+
+// IPLimitReason tells why a connection was refused
+type IPLimitReason string
+
+const (
+	IPLimitNone        IPLimitReason = ""
+	IPLimitConnections IPLimitReason = "ipConnections" // Too many concurrent connections
+	IPLimitRate        IPLimitReason = "ipRate"        // Too many new connections
+)
+
+// NewIPLimiter creates a limiter with the given limits, zero for no limit
+func NewIPLimiter(maxConnections int, perMinute int) *IPLimiter {
+	return &IPLimiter{
+		maxConnections: maxConnections,
+		perMinute:      float64(perMinute),
+		addresses:      make(map[string]*ipEntry),
+		lastSweep:      time.Now(),
+	}
+}
+
+// Reconfigure changes the limits, connections already open are kept even
+// if an address is now over the limit
+func (l *IPLimiter) Reconfigure(maxConnections int, perMinute int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.maxConnections = maxConnections
+	l.perMinute = float64(perMinute)
+}
+
+// Acquire counts a new connection from an address if it is within the
+// limits, otherwise it returns why it was refused and, for the rate limit,
+// how long until the address may try again
+func (l *IPLimiter) Acquire(ip string) (IPLimitReason, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= ipSweepInterval {
+		l.sweep(now)
+	}
+
+	entry, ok := l.addresses[ip]
+	if !ok {
+		entry = &ipEntry{tokens: l.perMinute, updated: now}
+		l.addresses[ip] = entry
+	}
+	l.refill(entry, now)
+
+	if l.maxConnections > 0 && entry.connections >= l.maxConnections {
+		return IPLimitConnections, 0
+	}
+	if l.perMinute > 0 {
+		if entry.tokens < 1 {
+			wait := time.Duration((1 - entry.tokens) / l.perMinute * float64(time.Minute))
+			return IPLimitRate, wait
+		}
+		entry.tokens--
+	}
+
+	entry.connections++
+	return IPLimitNone, 0
+}
+
+// Release counts a connection from an address as closed
+func (l *IPLimiter) Release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if entry, ok := l.addresses[ip]; ok && entry.connections > 0 {
+		entry.connections--
+	}
+}
+
+// refill adds the tokens earned since the entry was last updated
+func (l *IPLimiter) refill(entry *ipEntry, now time.Time) {
+	entry.tokens += now.Sub(entry.updated).Minutes() * l.perMinute
+	if entry.tokens > l.perMinute {
+		entry.tokens = l.perMinute
+	}
+	entry.updated = now
+}
+
+// sweep forgets addresses without connections that are back to a full
+// bucket, the mutex must be held
+func (l *IPLimiter) sweep(now time.Time) {
+	for ip, entry := range l.addresses {
+		l.refill(entry, now)
+		if entry.connections == 0 && entry.tokens >= l.perMinute {
+			delete(l.addresses, ip)
+		}
+	}
+	l.lastSweep = now
+}
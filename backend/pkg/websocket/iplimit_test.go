@@ -0,0 +1,66 @@
+package websocket
+
+import "testing"
+
+func TestIPLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxConnections int
+		perMinute      int
+		release        bool // Release each connection right after acquiring it
+		want           []IPLimitReason
+	}{
+		{
+			name: "no limits",
+			want: []IPLimitReason{IPLimitNone, IPLimitNone, IPLimitNone},
+		},
+		{
+			name:           "concurrent connections",
+			maxConnections: 2,
+			want:           []IPLimitReason{IPLimitNone, IPLimitNone, IPLimitConnections},
+		},
+		{
+			name:           "released connections",
+			maxConnections: 1,
+			release:        true,
+			want:           []IPLimitReason{IPLimitNone, IPLimitNone, IPLimitNone},
+		},
+		{
+			name:      "connection rate",
+			perMinute: 2,
+			release:   true,
+			want:      []IPLimitReason{IPLimitNone, IPLimitNone, IPLimitRate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewIPLimiter(tt.maxConnections, tt.perMinute)
+			for i, want := range tt.want {
+				reason, wait := limiter.Acquire("198.51.100.1")
+				if reason != want {
+					t.Fatalf("connection %d: Acquire() = %q, want %q", i+1, reason, want)
+				}
+				if (reason == IPLimitRate) != (wait > 0) {
+					t.Errorf("connection %d: refused with %q and a wait of %v", i+1, reason, wait)
+				}
+				if tt.release && reason == IPLimitNone {
+					limiter.Release("198.51.100.1")
+				}
+			}
+		})
+	}
+}
+
+func TestIPLimiterSeparateAddresses(t *testing.T) {
+	limiter := NewIPLimiter(1, 0)
+	if reason, _ := limiter.Acquire("198.51.100.1"); reason != IPLimitNone {
+		t.Fatalf("first address refused with %q", reason)
+	}
+	if reason, _ := limiter.Acquire("198.51.100.2"); reason != IPLimitNone {
+		t.Errorf("second address refused with %q", reason)
+	}
+	if reason, _ := limiter.Acquire("198.51.100.1"); reason != IPLimitConnections {
+		t.Errorf("first address over its limit got %q", reason)
+	}
+}
@@ -0,0 +1,29 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// tickHandler is a slog.Handler that adds the hub's current tick to every record
+type tickHandler struct {
+	slog.Handler
+	tick *atomic.Uint64
+}
+
+// Handle adds the tick attribute and passes the record to the wrapped handler
+func (t *tickHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.AddAttrs(slog.Uint64("tick", t.tick.Load()))
+	return t.Handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a tickHandler wrapping a handler with the given attributes
+func (t *tickHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &tickHandler{Handler: t.Handler.WithAttrs(attrs), tick: t.tick}
+}
+
+// WithGroup returns a tickHandler wrapping a handler with the given group
+func (t *tickHandler) WithGroup(name string) slog.Handler {
+	return &tickHandler{Handler: t.Handler.WithGroup(name), tick: t.tick}
+}
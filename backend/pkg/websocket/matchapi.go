@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Entries returned by a list when no limit is given, and at most
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// MatchesHandler serves the results history under /api/matches
+//
+//	GET /api/matches       lists finished matches, newest first, paged with
+//	                       the limit and offset query parameters
+//	GET /api/matches/{id}  returns the result of a single match
+func MatchesHandler(hub *Hub, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/matches", func(w http.ResponseWriter, r *http.Request) {
+		offset, limit, ok := queryPage(w, r)
+		if !ok {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"matches": hub.Matches().List(offset, limit),
+			"total":   hub.Matches().Len(),
+		})
+	})
+
+	mux.HandleFunc("GET /api/matches/{id}", func(w http.ResponseWriter, r *http.Request) {
+		match, ok := hub.Matches().Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "match not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, match)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Debug("Match history request", "method", r.Method, "path", r.URL.Path)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// queryPage parses the limit and offset query parameters of a list,
+// writing the HTTP error and returning false if they are invalid
+func queryPage(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxPageLimit), http.StatusBadRequest)
+		return 0, 0, false
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return offset, limit, true
+}
+
+// queryInt parses an integer query parameter, returning the fallback if it
+// isn't set
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
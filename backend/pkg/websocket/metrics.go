@@ -0,0 +1,266 @@
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// Histogram is a minimal Prometheus-style histogram with fixed buckets
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64 // Upper bounds, in ascending order
+	counts  []uint64  // Observations per bucket (not cumulative)
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds
+func NewHistogram(buckets ...float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe records a single value
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// write renders the histogram in the Prometheus text format
+func (h *Histogram) write(w io.Writer, name string, help string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// CounterVec is a set of counters partitioned by a single label
+type CounterVec struct {
+	mutex  sync.Mutex
+	values map[string]*atomic.Uint64
+}
+
+// NewCounterVec creates an empty counter vector
+func NewCounterVec() *CounterVec {
+	return &CounterVec{values: make(map[string]*atomic.Uint64)}
+}
+
+// Add increases the counter for the given label value
+func (c *CounterVec) Add(label string, n uint64) {
+	c.mutex.Lock()
+	counter, ok := c.values[label]
+	if !ok {
+		counter = &atomic.Uint64{}
+		c.values[label] = counter
+	}
+	c.mutex.Unlock()
+
+	counter.Add(n)
+}
+
+// write renders the counters in the Prometheus text format, sorted by label value
+func (c *CounterVec) write(w io.Writer, name string, help string, labelName string) {
+	c.mutex.Lock()
+	values := make(map[string]uint64, len(c.values))
+	labels := make([]string, 0, len(c.values))
+	for label, counter := range c.values {
+		values[label] = counter.Load()
+		labels = append(labels, label)
+	}
+	c.mutex.Unlock()
+	sort.Strings(labels)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, labelName, label, values[label])
+	}
+}
+
+// Metrics holds the counters the hub maintains for the /metrics endpoint
+type Metrics struct {
+	// Number of game ticks produced
+	TicksTotal atomic.Uint64
+
+	// Number of game sessions that have been reset
+	ResetsTotal atomic.Uint64
+
+	// Messages that could not be queued on the hub's broadcast channel
+	HubBroadcastDrops atomic.Uint64
+
+	// Messages that could not be queued on a client's send channel
+	ClientBroadcastDrops atomic.Uint64
+
+	// Time spent processing each tick, in seconds
+	TickDuration *Histogram
+
+	// Difference between the actual and configured time between ticks, in seconds
+	TickDrift *Histogram
+
+	// Number of inputs included in each tick
+	TickInputs *Histogram
+
+	// Depth of client send queues sampled on every broadcast
+	SendQueueDepth *Histogram
+
+	// Bytes written to clients, by message type
+	BytesSent *CounterVec
+
+	// WebSocket upgrades refused before a client was created, by reason
+	RejectedUpgrades *CounterVec
+
+	// Clients that started speaking the protocol, by protocol version
+	ClientProtocols *CounterVec
+
+	// Idle players moved to the spectators or disconnected, by action
+	AFKKicks *CounterVec
+
+	// Match results recorded, by whether a majority of the players agreed
+	MatchResults *CounterVec
+
+	// Time the previous tick was produced, used to measure drift
+	lastTickAt time.Time
+}
+
+// NewMetrics creates an empty set of hub metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		TickDuration:     NewHistogram(0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05),
+		TickDrift:        NewHistogram(0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25),
+		TickInputs:       NewHistogram(0, 1, 2, 5, 10, 25, 50, 100, 250, 500),
+		SendQueueDepth:   NewHistogram(0, 1, 2, 4, 8, 16, 32, 64, 128, 256),
+		BytesSent:        NewCounterVec(),
+		RejectedUpgrades: NewCounterVec(),
+		ClientProtocols:  NewCounterVec(),
+		AFKKicks:         NewCounterVec(),
+		MatchResults:     NewCounterVec(),
+	}
+}
+
+// AddBytesSent records bytes written to a client for a message type
+func (m *Metrics) AddBytesSent(messageType types.MessageType, n int) {
+	m.BytesSent.Add(string(messageType), uint64(n))
+}
+
+// observeTick records the duration, drift and input count of a processed tick
+func (m *Metrics) observeTick(start time.Time, interval time.Duration, inputCount int) {
+	m.TicksTotal.Add(1)
+	m.TickDuration.Observe(time.Since(start).Seconds())
+	m.TickInputs.Observe(float64(inputCount))
+
+	if !m.lastTickAt.IsZero() {
+		drift := start.Sub(m.lastTickAt) - interval
+		if drift < 0 {
+			drift = -drift
+		}
+		m.TickDrift.Observe(drift.Seconds())
+	}
+	m.lastTickAt = start
+}
+
+// clockStopped forgets the previous tick when the hub stops producing ticks,
+// so the time until they start again isn't recorded as drift
+func (m *Metrics) clockStopped() {
+	m.lastTickAt = time.Time{}
+}
+
+// HandleMetrics writes the hub's metrics in the Prometheus text exposition format
+func HandleMetrics(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	hub.ClientsMutex.Lock()
+	playerCount, spectatorCount := hub.countRoles()
+	delayedCount := len(hub.delayedClients)
+	hub.ClientsMutex.Unlock()
+
+	hub.presenceMutex.Lock()
+	queuedCount := len(hub.queue)
+	hub.presenceMutex.Unlock()
+
+	phase := hub.Phase()
+
+	hub.InputMutex.Lock()
+	historySize := len(hub.TickHistory)
+	currentTick := hub.CurrentTick
+	hub.InputMutex.Unlock()
+
+	m := hub.Metrics
+
+	fmt.Fprintf(w, "# HELP blobberman_connected_clients Number of connected WebSocket clients by role.\n")
+	fmt.Fprintf(w, "# TYPE blobberman_connected_clients gauge\n")
+	fmt.Fprintf(w, "blobberman_connected_clients{role=\"player\"} %d\n", playerCount)
+	fmt.Fprintf(w, "blobberman_connected_clients{role=\"spectator\"} %d\n", spectatorCount)
+	fmt.Fprintf(w, "blobberman_connected_clients{role=\"delayed\"} %d\n", delayedCount)
+	writeGauge(w, "blobberman_queued_players", "Number of players waiting in the join queue for a free slot.", float64(queuedCount))
+	fmt.Fprintf(w, "# HELP blobberman_match_phase Phase of the match, 1 for the current phase.\n")
+	fmt.Fprintf(w, "# TYPE blobberman_match_phase gauge\n")
+	for _, p := range []types.MatchPhase{types.PhaseWaiting, types.PhaseStarting, types.PhasePlaying, types.PhaseResults, types.PhaseResetting} {
+		value := 0
+		if p == phase {
+			value = 1
+		}
+		fmt.Fprintf(w, "blobberman_match_phase{phase=%q} %d\n", p, value)
+	}
+	writeGauge(w, "blobberman_current_tick", "Current tick of the running match.", float64(currentTick))
+	writeGauge(w, "blobberman_history_ticks", "Number of ticks held in the match history.", float64(historySize))
+	writeCounter(w, "blobberman_ticks_total", "Total number of game ticks produced.", m.TicksTotal.Load())
+	writeCounter(w, "blobberman_resets_total", "Total number of game session resets.", m.ResetsTotal.Load())
+
+	fmt.Fprintf(w, "# HELP blobberman_broadcast_drops_total Messages dropped because a queue was full.\n")
+	fmt.Fprintf(w, "# TYPE blobberman_broadcast_drops_total counter\n")
+	fmt.Fprintf(w, "blobberman_broadcast_drops_total{queue=\"hub\"} %d\n", m.HubBroadcastDrops.Load())
+	fmt.Fprintf(w, "blobberman_broadcast_drops_total{queue=\"client\"} %d\n", m.ClientBroadcastDrops.Load())
+
+	m.TickDuration.write(w, "blobberman_tick_duration_seconds", "Time spent processing a game tick.")
+	m.TickDrift.write(w, "blobberman_tick_drift_seconds", "Absolute difference between the actual and configured tick interval.")
+	m.TickInputs.write(w, "blobberman_tick_inputs", "Number of player inputs included in a tick.")
+	m.SendQueueDepth.write(w, "blobberman_send_queue_depth", "Client send queue depth sampled on each broadcast.")
+
+	m.BytesSent.write(w, "blobberman_sent_bytes_total", "Bytes written to clients by message type.", "type")
+	m.RejectedUpgrades.write(w, "blobberman_rejected_upgrades_total", "WebSocket upgrades refused by reason.", "reason")
+	m.ClientProtocols.write(w, "blobberman_client_protocols_total", "Clients accepted by negotiated protocol version.", "version")
+	m.AFKKicks.write(w, "blobberman_afk_kicks_total", "Idle players moved to the spectators or disconnected, by action.", "action")
+	m.MatchResults.write(w, "blobberman_match_results_total", "Match results recorded, by whether a majority of the players confirmed them.", "result")
+}
+
+// writeGauge writes a single unlabelled gauge
+func writeGauge(w io.Writer, name string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
+
+// writeCounter writes a single unlabelled counter
+func writeCounter(w io.Writer, name string, help string, value uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
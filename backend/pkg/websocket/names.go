@@ -0,0 +1,25 @@
+package websocket
+
+import (
+	"errors"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/names"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// nameErrorCode returns the error code telling a player why their display
+// name was refused
+func nameErrorCode(err error) string {
+	switch {
+	case errors.Is(err, names.ErrEmpty):
+		return types.ErrorCodeNameEmpty
+	case errors.Is(err, names.ErrTooLong):
+		return types.ErrorCodeNameTooLong
+	case errors.Is(err, names.ErrTaken):
+		return types.ErrorCodeNameTaken
+	case errors.Is(err, names.ErrReserved):
+		return types.ErrorCodeNameReserved
+	default:
+		return types.ErrorCodeNameInvalid
+	}
+}
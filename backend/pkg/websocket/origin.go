@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginPolicy decides which browser origins may open WebSocket connections
+//
+// Patterns are either "*", a full origin such as "https://example.com", a
+// wildcard subdomain origin such as "https://*.example.com", or a bare host
+// such as "example.com" or "*.example.com" which matches any scheme. Pages
+// served by this server are always allowed, as are requests without an
+// Origin header, which don't come from browsers.
+type OriginPolicy struct {
+	patterns []string
+	devMode  bool
+}
+
+// NewOriginPolicy creates a policy allowing the given origin patterns, in dev
+// mode every origin is allowed
+func NewOriginPolicy(allowedOrigins []string, devMode bool) *OriginPolicy {
+	patterns := make([]string, 0, len(allowedOrigins))
+	for _, pattern := range allowedOrigins {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), "/")
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return &OriginPolicy{patterns: patterns, devMode: devMode}
+}
+
+// Allowed reports whether the request's origin may open a WebSocket connection
+func (p *OriginPolicy) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if p.devMode || origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	// Same-origin requests come from the frontend served by this server
+	if u.Host == strings.ToLower(r.Host) {
+		return true
+	}
+
+	for _, pattern := range p.patterns {
+		if matchOrigin(pattern, u.Scheme, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin matches a lower-cased origin scheme and host against a pattern
+func matchOrigin(pattern string, scheme string, host string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	if patternScheme, patternHost, ok := strings.Cut(pattern, "://"); ok {
+		if patternScheme != scheme {
+			return false
+		}
+		pattern = patternHost
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
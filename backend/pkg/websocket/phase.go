@@ -0,0 +1,193 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+// The match moves through its phases in order, starting over after each
+// game session:
+//
+//	waiting    until MinPlayers players are connected, or WaitingTimeoutSec has
+//	           passed with at least one
+//	starting   counts down StartCountdownSec, going back to waiting if players
+//	           leave
+//	playing    ticks until the match reaches its maximum length
+//	results    shows the outcome for ResetTimeoutSec
+//	resetting  clears the match and pauses for ResetPauseSec before waiting
+//	           for players again
+//
+// The phase is owned by Run, and the match clock only runs while playing.
+
+// setPhase moves the match to a phase lasting the given time, zero for a
+// phase that only ends when players join or leave, and tells every client
+func (h *Hub) setPhase(phase types.MatchPhase, duration time.Duration) {
+	if h.phaseTimer != nil {
+		h.phaseTimer.Stop()
+		h.phaseTimer = nil
+	}
+	if duration > 0 {
+		h.phaseTimer = time.NewTimer(duration)
+	}
+
+	previous := h.phase
+	h.phase = phase
+	if phase == types.PhasePlaying {
+		h.matchStartedAt = time.Now()
+	}
+
+	message := &types.PhaseMessage{
+		Type:        types.MessageTypePhase,
+		Phase:       phase,
+		DurationSec: int(duration.Seconds()),
+		MinPlayers:  h.minPlayers,
+	}
+	if duration > 0 {
+		message.EndsAt = time.Now().Add(duration).UnixMilli()
+	}
+	h.phaseMessage.Store(message)
+
+	h.logger.Info("Match phase changed", "from", previous, "to", phase, "durationSec", message.DurationSec)
+	h.updateClock()
+
+	select {
+	case h.Broadcast <- *message:
+	default:
+		h.Metrics.HubBroadcastDrops.Add(1)
+		h.logger.Warn("Failed to broadcast match phase", "phase", phase)
+	}
+}
+
+// Phase returns the current phase of the match
+func (h *Hub) Phase() types.MatchPhase {
+	return h.phaseMessage.Load().Phase
+}
+
+// SendPhaseToClient tells a single client the current phase of the match
+func (h *Hub) SendPhaseToClient(client *common.Client) {
+	select {
+	case client.SendChan <- *h.phaseMessage.Load():
+		client.Logger().Debug("Sent match phase")
+	default:
+		client.Logger().Warn("Failed to send match phase")
+	}
+}
+
+// endPhase moves on from a phase whose time is up, from within Run
+func (h *Hub) endPhase() {
+	h.phaseTimer = nil
+
+	switch h.phase {
+	case types.PhaseWaiting:
+		// Waited long enough for more players, start with those who came
+		h.startCountdown()
+
+	case types.PhaseStarting:
+		h.setPhase(types.PhasePlaying, 0)
+
+	case types.PhaseResults:
+		h.resetGameSession()
+		h.setPhase(types.PhaseResetting, time.Duration(h.resetPauseSec)*time.Second)
+		if h.resetPauseSec <= 0 {
+			h.wait()
+		}
+
+	case types.PhaseResetting:
+		h.wait()
+	}
+}
+
+// wait starts waiting for players, moving on at once if enough are here
+func (h *Hub) wait() {
+	h.setPhase(types.PhaseWaiting, 0)
+	h.playersChanged()
+}
+
+// startCountdown starts the countdown to the match, or the match itself
+// without a countdown
+func (h *Hub) startCountdown() {
+	if h.startCountdownSec <= 0 {
+		h.setPhase(types.PhasePlaying, 0)
+		return
+	}
+	h.setPhase(types.PhaseStarting, time.Duration(h.startCountdownSec)*time.Second)
+}
+
+// joinedPlayers counts the connected players who joined the match, leaving
+// out clients waiting in the join queue or that haven't sent their player
+// ID yet
+func (h *Hub) joinedPlayers() int {
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	players := make(map[string]bool, len(h.joined))
+	for client, playerID := range h.joined {
+		if !client.Spectator.Load() {
+			players[playerID] = true
+		}
+	}
+	return len(players)
+}
+
+// notifyJoined tells Run that a player joined or left, so it can start or
+// call off the match, the presence mutex must be held
+func (h *Hub) notifyJoined() {
+	select {
+	case h.joinedChanged <- struct{}{}:
+	default:
+		// Run hasn't caught up with the previous change yet
+	}
+}
+
+// playersChanged suspends or resumes the match when the last player leaves
+// or the first one joins, and starts or calls off the countdown as players
+// come and go, from within Run
+func (h *Hub) playersChanged() {
+	playerCount := h.joinedPlayers()
+
+	if playerCount == 0 && !h.suspended {
+		h.suspend()
+	} else if playerCount > 0 && h.suspended {
+		h.resume()
+	}
+
+	switch h.phase {
+	case types.PhaseWaiting:
+		if playerCount > 0 && playerCount >= h.minPlayers {
+			h.startCountdown()
+			return
+		}
+
+		// The waiting timeout only runs while someone is waiting
+		if playerCount > 0 && h.waitingTimeoutSec > 0 && h.phaseTimer == nil {
+			h.setPhase(types.PhaseWaiting, time.Duration(h.waitingTimeoutSec)*time.Second)
+		} else if playerCount == 0 && h.phaseTimer != nil {
+			h.setPhase(types.PhaseWaiting, 0)
+		}
+
+	case types.PhaseStarting:
+		if playerCount == 0 || playerCount < h.minPlayers && h.waitingTimeoutSec <= 0 {
+			h.logger.Info("Not enough players, calling off the countdown", "players", playerCount, "minPlayers", h.minPlayers)
+			h.wait()
+		}
+	}
+}
+
+// updateClock runs the match clock while playing, unless no players are
+// connected
+func (h *Hub) updateClock() {
+	run := h.phase == types.PhasePlaying && !h.suspended
+	if run == h.ticking {
+		return
+	}
+	h.ticking = run
+
+	if !run {
+		h.ticker.Stop()
+		h.Metrics.clockStopped()
+		return
+	}
+	h.ticker.Reset(time.Duration(h.tickInterval) * time.Millisecond)
+}
@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/profiles"
+)
+
+// PlayersHandler serves the player profiles under /api/players
+//
+//	GET /api/players       lists players as a leaderboard, ordered by the
+//	                       sort query parameter (rating, wins, matches, tiles,
+//	                       bombs, hits or recent) and paged with limit and
+//	                       offset
+//	GET /api/players/{id}  returns a player's profile
+//	GET /api/players/{id}/ratings
+//	                       lists a player's rating changes, newest first,
+//	                       paged with limit and offset
+func PlayersHandler(hub *Hub, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/players", func(w http.ResponseWriter, r *http.Request) {
+		offset, limit, ok := queryPage(w, r)
+		if !ok {
+			return
+		}
+		sortBy := r.URL.Query().Get("sort")
+		if sortBy == "" {
+			sortBy = profiles.DefaultSort
+		}
+
+		leaderboard, err := hub.Profiles().Leaderboard(sortBy, offset, limit)
+		if errors.Is(err, profiles.ErrUnknownSort) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"sort":    sortBy,
+			"players": leaderboard,
+			"total":   hub.Profiles().Len(),
+		})
+	})
+
+	mux.HandleFunc("GET /api/players/{id}", func(w http.ResponseWriter, r *http.Request) {
+		profile, ok := hub.Profiles().Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "player not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+	})
+
+	mux.HandleFunc("GET /api/players/{id}/ratings", func(w http.ResponseWriter, r *http.Request) {
+		offset, limit, ok := queryPage(w, r)
+		if !ok {
+			return
+		}
+		profile, found := hub.Profiles().Get(r.PathValue("id"))
+		if !found {
+			http.Error(w, "player not found", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"playerId": profile.PlayerID,
+			"rating":   profile.Rating,
+			"history":  hub.Profiles().RatingHistory(profile.PlayerID, offset, limit),
+		})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Debug("Player profile request", "method", r.Method, "path", r.URL.Path)
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"encoding/json"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+	"github.com/gorilla/websocket"
+)
+
+// preparedMessage is a broadcast message encoded once for every client
+//
+// The JSON encoding, and the binary one if the message has one, are wrapped
+// in gorilla's PreparedMessage, which also compresses each of them once for
+// all the connections that negotiated permessage-deflate.
+type preparedMessage struct {
+	common.ClientMessage
+	text       *websocket.PreparedMessage
+	textSize   int
+	binary     *websocket.PreparedMessage // nil without a binary encoding
+	binarySize int
+}
+
+// prepare encodes a broadcast message, returning the message unchanged if it
+// can't be encoded so that each write pump reports the error
+func (h *Hub) prepare(message common.ClientMessage) common.ClientMessage {
+	data, err := json.Marshal(message)
+	if err != nil {
+		h.logger.Error("Error marshalling broadcast message", "type", message.GetType(), "error", err)
+		return message
+	}
+
+	text, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
+	if err != nil {
+		h.logger.Error("Error preparing broadcast message", "type", message.GetType(), "error", err)
+		return message
+	}
+
+	prepared := preparedMessage{ClientMessage: message, text: text, textSize: len(data)}
+
+	if binaryMsg, ok := message.(binaryMessage); ok {
+		frame := binaryMsg.binaryFrame()
+		prepared.binary, err = websocket.NewPreparedMessage(websocket.BinaryMessage, frame)
+		if err != nil {
+			h.logger.Error("Error preparing binary broadcast message", "type", message.GetType(), "error", err)
+			return message
+		}
+		prepared.binarySize = len(frame)
+	}
+
+	return prepared
+}
@@ -0,0 +1,306 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+// presence tracks whether a player of the match is online
+type presence struct {
+	joinedAt    time.Time   // Time of the player's latest join
+	leftAt      time.Time   // Time the player's last connection closed
+	connections int         // Open connections of the player, zero once they have left
+	token       string      // Session token proving a client is this player, empty once they have left
+	grace       *time.Timer // Runs while the player is reconnecting, nil otherwise
+}
+
+// active reports whether the player is online or within the reconnect grace
+// period, and so holds their slot in the match
+func (p *presence) active() bool {
+	return p.connections > 0 || p.grace != nil
+}
+
+// ErrSessionInvalid is returned when a client claims a player ID whose slot
+// is held by a session it can't prove it owns
+var ErrSessionInvalid = errors.New("player is already in the match, reconnect with its session token")
+
+// Join marks a client as playing as the given player, broadcasting
+// playerJoined the first time the player joins the match and
+// playerReconnected when they come back, and returns the session token the
+// client reconnects with. A client that already joined as another player
+// leaves first, and spectators never join.
+//
+// While the player is online or reconnecting their slot is held for them,
+// and a client must present the player's session token to join as them.
+// Clients still speaking the legacy protocol predate session tokens, so
+// their claims are accepted while LegacySessions is set.
+//
+// When every slot of the room is taken the client is queued instead, and
+// Join returns its position in the queue with no session token. A valid
+// priority token puts it ahead of everyone queued without one.
+//
+// Join must only be called from the client's read pump, which always
+// unregisters the client afterwards, so a client the hub disconnected in the
+// meantime still leaves again.
+func (h *Hub) Join(client *common.Client, playerID string, token string, priorityToken string) (string, int, error) {
+	if client.Spectator.Load() {
+		return "", 0, nil
+	}
+
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	p, known := h.presence[playerID]
+	if joinedAs, ok := h.joined[client]; ok && joinedAs == playerID {
+		return p.token, 0, nil
+	}
+
+	if known && p.active() && subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+		if !h.isLegacy(client) || !h.legacySessions.Load() {
+			return "", 0, ErrSessionInvalid
+		}
+		client.Logger().Warn("Accepted legacy client without a session token", "player", playerID)
+	}
+
+	if _, ok := h.joined[client]; ok {
+		h.leaveLocked(client, h.reconnectGrace())
+	}
+	h.dequeueLocked(client)
+
+	// Players holding a slot come back at once, everyone else waits for one
+	if !(known && p.active()) && h.maxPlayers > 0 && h.activePlayersLocked() >= h.maxPlayers {
+		return "", h.enqueueLocked(client, playerID, h.priorityTokens[priorityToken]), nil
+	}
+
+	return h.joinLocked(client, playerID), 0, nil
+}
+
+// joinLocked marks a client as playing as the given player and returns the
+// player's session token, the presence mutex must be held
+func (h *Hub) joinLocked(client *common.Client, playerID string) string {
+	now := time.Now()
+	p, known := h.presence[playerID]
+	if !known {
+		p = &presence{}
+		h.presence[playerID] = p
+	}
+	if p.token == "" {
+		p.token = newSessionToken()
+	}
+	h.joined[client] = playerID
+	h.notifyJoined()
+	h.resetIdle(playerID)
+	p.connections++
+	if p.connections > 1 {
+		client.Logger().Debug("Player opened another connection", "connections", p.connections)
+		return p.token
+	}
+
+	// Coming back within the grace period resumes the session as if the
+	// player had never left
+	if p.grace != nil {
+		p.grace.Stop()
+		p.grace = nil
+		h.ClientLogger(playerID).Info("Player resumed session", "offlineFor", now.Sub(p.leftAt).Round(time.Millisecond))
+		h.broadcastPresence(types.MessageTypeReconnected, playerID, now)
+		return p.token
+	}
+	p.joinedAt = now
+
+	messageType := types.MessageTypeJoined
+	if known {
+		messageType = types.MessageTypeReconnected
+	}
+	h.ClientLogger(playerID).Info("Player online", "event", messageType)
+	displayName := h.broadcastPresence(messageType, playerID, now)
+	h.RecordEvent(types.GameEvent{Kind: types.EventJoin, PlayerID: playerID, Value: displayName})
+	return p.token
+}
+
+// leave marks the player of a client that has disconnected as offline once
+// their last connection has closed
+func (h *Hub) leave(client *common.Client) {
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	h.leaveLocked(client, h.reconnectGrace())
+}
+
+// reconnectGrace returns how long a disconnected player's slot is held
+func (h *Hub) reconnectGrace() time.Duration {
+	return time.Duration(h.reconnectGraceSec.Load()) * time.Second
+}
+
+// leaveLocked is leave with the presence mutex held
+//
+// With a reconnect grace period the player is broadcast as reconnecting and
+// keeps their slot until it expires, only then are they broadcast as having
+// left and a leave event recorded.
+func (h *Hub) leaveLocked(client *common.Client, grace time.Duration) {
+	playerID, ok := h.joined[client]
+	if !ok {
+		h.dequeueLocked(client)
+		return
+	}
+	delete(h.joined, client)
+	h.notifyJoined()
+
+	p := h.presence[playerID]
+	p.connections--
+	if p.connections > 0 {
+		return
+	}
+
+	now := time.Now()
+	p.leftAt = now
+	if grace <= 0 {
+		h.leftLocked(playerID, p, now)
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(grace, func() {
+		h.presenceMutex.Lock()
+		defer h.presenceMutex.Unlock()
+
+		if p.grace == timer {
+			h.ClientLogger(playerID).Info("Reconnect grace period expired")
+			h.leftLocked(playerID, p, time.Now())
+		}
+	})
+	p.grace = timer
+
+	h.ClientLogger(playerID).Info("Player reconnecting", "graceSec", int(grace.Seconds()))
+	h.broadcastPresence(types.MessageTypeReconnecting, playerID, now)
+}
+
+// leftLocked marks a player as having left the match, the presence mutex
+// must be held
+func (h *Hub) leftLocked(playerID string, p *presence, at time.Time) {
+	p.grace = nil
+	p.token = ""
+
+	h.ClientLogger(playerID).Info("Player offline")
+	h.broadcastPresence(types.MessageTypeLeft, playerID, at)
+	h.RecordEvent(types.GameEvent{Kind: types.EventLeave, PlayerID: playerID})
+
+	// The player's slot is free for the next one waiting
+	h.promoteLocked()
+}
+
+// isLegacy reports whether a client speaks the legacy protocol
+func (h *Hub) isLegacy(client *common.Client) bool {
+	client.Mutex.Lock()
+	defer client.Mutex.Unlock()
+	return client.ProtocolVersion < ProtocolVersion
+}
+
+// newSessionToken creates a random session token
+func newSessionToken() string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// broadcastPresence broadcasts a presence event and returns the player's
+// display name, the presence mutex must be held so events reach clients in
+// order
+func (h *Hub) broadcastPresence(messageType types.MessageType, playerID string, at time.Time) string {
+	h.DisplayNamesMutex.Lock()
+	displayName := h.DisplayNames[playerID]
+	h.DisplayNamesMutex.Unlock()
+
+	select {
+	case h.Broadcast <- types.PresenceMessage{
+		Type:        messageType,
+		PlayerID:    playerID,
+		DisplayName: displayName,
+		Timestamp:   at.UnixMilli(),
+	}:
+	default:
+		h.Metrics.HubBroadcastDrops.Add(1)
+		h.ClientLogger(playerID).Warn("Failed to broadcast presence", "event", messageType)
+	}
+	return displayName
+}
+
+// SendRosterToClient sends the players who are online or reconnecting to a
+// single client
+func (h *Hub) SendRosterToClient(client *common.Client) {
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	h.sendRosterLocked(client)
+}
+
+// sendRosterLocked is SendRosterToClient with the presence mutex held
+func (h *Hub) sendRosterLocked(client *common.Client) {
+	roster := make([]types.RosterEntry, 0, len(h.presence))
+	for playerID, p := range h.presence {
+		if p.active() {
+			roster = append(roster, types.RosterEntry{
+				PlayerID:     playerID,
+				JoinedAt:     p.joinedAt.UnixMilli(),
+				Reconnecting: p.connections == 0,
+			})
+		}
+	}
+
+	sort.Slice(roster, func(i, j int) bool { return roster[i].JoinedAt < roster[j].JoinedAt })
+
+	h.DisplayNamesMutex.Lock()
+	for i := range roster {
+		roster[i].DisplayName = h.DisplayNames[roster[i].PlayerID]
+	}
+	h.DisplayNamesMutex.Unlock()
+
+	for i := range roster {
+		roster[i].Rating = h.rating(roster[i].PlayerID)
+	}
+
+	select {
+	case client.SendChan <- types.RosterMessage{Type: types.MessageTypeRoster, Players: roster}:
+		client.Logger().Debug("Sent roster", "players", len(roster))
+	default:
+		client.Logger().Warn("Failed to send roster")
+	}
+}
+
+// restartPresence drops the players who have left, so they join the next
+// game session as new players, and records a join event for every player
+// still online or reconnecting so the history of the new session starts
+// with them
+func (h *Hub) restartPresence() {
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	online := make([]string, 0, len(h.presence))
+	for playerID, p := range h.presence {
+		if !p.active() {
+			delete(h.presence, playerID)
+		} else {
+			online = append(online, playerID)
+		}
+	}
+	sort.Slice(online, func(i, j int) bool {
+		return h.presence[online[i]].joinedAt.Before(h.presence[online[j]].joinedAt)
+	})
+
+	h.DisplayNamesMutex.Lock()
+	events := make([]types.GameEvent, 0, len(online))
+	for _, playerID := range online {
+		events = append(events, types.GameEvent{Kind: types.EventJoin, PlayerID: playerID, Value: h.DisplayNames[playerID]})
+	}
+	h.DisplayNamesMutex.Unlock()
+
+	for _, event := range events {
+		h.RecordEvent(event)
+	}
+}
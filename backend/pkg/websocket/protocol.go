@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+const (
+	// ProtocolVersionLegacy is the original unversioned protocol, spoken by
+	// clients that never send a hello
+	ProtocolVersionLegacy = 1
+
+	// ProtocolVersion is the newest protocol version the server speaks
+	ProtocolVersion = 2
+
+	// WebSocket close code sent after refusing a client's protocol version
+	CloseUnsupportedVersion = 4000
+)
+
+// Capabilities a client can ask for in its hello
+const (
+	CapabilityCompression = "compression" // Compressed WebSocket frames
+	CapabilityBinary      = "binary"      // Binary encoded ticks
+	CapabilityResume      = "resume"      // Resuming a session after reconnecting
+)
+
+// ServerCapabilities lists the capabilities this server implements, a hello
+// is answered with the ones both sides support
+var ServerCapabilities = []string{CapabilityCompression, CapabilityBinary, CapabilityResume}
+
+// subprotocolPrefix is followed by the protocol version in the WebSocket
+// subprotocols the server accepts
+const subprotocolPrefix = "blobberman.v"
+
+// subprotocolVersion returns the protocol version declared by a negotiated
+// WebSocket subprotocol, or zero if the client didn't offer one
+func subprotocolVersion(subprotocol string) int {
+	suffix, ok := strings.CutPrefix(subprotocol, subprotocolPrefix)
+	if !ok {
+		return 0
+	}
+	version, err := strconv.Atoi(suffix)
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+// minProtocolVersion returns the oldest protocol version clients may speak,
+// the legacy protocol is accepted unless the hub requires a hello
+func (h *Hub) minProtocolVersion() int {
+	if h.requireHello.Load() {
+		return ProtocolVersionLegacy + 1
+	}
+	return ProtocolVersionLegacy
+}
+
+// negotiate answers a client's hello with the negotiated protocol version and
+// capabilities, returning false if the version was refused and the client
+// is being disconnected
+func (h *Hub) negotiate(client *common.Client, hello types.HelloMessage) bool {
+	minVersion := h.minProtocolVersion()
+	if hello.ProtocolVersion < minVersion || hello.ProtocolVersion > ProtocolVersion {
+		h.refuseVersion(client, hello.ProtocolVersion,
+			fmt.Sprintf("protocol version %d is not supported", hello.ProtocolVersion))
+		return false
+	}
+
+	capabilities := make([]string, 0, len(hello.Capabilities))
+	for _, capability := range hello.Capabilities {
+		if !slices.Contains(ServerCapabilities, capability) || slices.Contains(capabilities, capability) {
+			continue
+		}
+
+		// Compression is negotiated by the WebSocket handshake, the hello
+		// only confirms whether it is in effect
+		if capability == CapabilityCompression && !client.Compressed {
+			continue
+		}
+		capabilities = append(capabilities, capability)
+	}
+
+	client.Mutex.Lock()
+	client.ProtocolVersion = hello.ProtocolVersion
+	client.Capabilities = capabilities
+	client.Mutex.Unlock()
+
+	// Players may ask to watch instead, spectators can't become players
+	if hello.Role == types.RoleSpectator && !h.Spectate(client) {
+		h.sendError(client, types.ErrorCodeSpectatorsFull, "the match has no room for more spectators")
+	}
+	role := types.RolePlayer
+	if client.Spectator.Load() {
+		role = types.RoleSpectator
+	}
+
+	h.Metrics.ClientProtocols.Add("v"+strconv.Itoa(hello.ProtocolVersion), 1)
+	client.Logger().Info("Negotiated protocol",
+		"protocolVersion", hello.ProtocolVersion, "capabilities", capabilities, "requested", hello.Capabilities, "role", role)
+
+	helloMsg := types.HelloMessage{
+		Type:            types.MessageTypeHello,
+		ProtocolVersion: hello.ProtocolVersion,
+		Capabilities:    capabilities,
+		Role:            role,
+	}
+
+	select {
+	case client.SendChan <- helloMsg:
+		client.Logger().Debug("Hello message sent")
+	default:
+		client.Logger().Warn("Failed to send hello message")
+	}
+
+	// Binary ticks refer to players by index, so catch the client up with
+	// the players of the running match, the write pump switches to binary
+	// frames at the table
+	if slices.Contains(capabilities, CapabilityBinary) {
+		h.sendPlayerTable(client)
+	}
+	return true
+}
+
+// acceptWithoutHello decides whether a client that sent another message
+// before a hello may stay connected, speaking the protocol version declared
+// by its WebSocket subprotocol or the legacy protocol if it declared none
+func (h *Hub) acceptWithoutHello(client *common.Client) bool {
+	client.Mutex.Lock()
+	version := client.ProtocolVersion
+	if version == 0 {
+		version = ProtocolVersionLegacy
+		client.ProtocolVersion = version
+	}
+	client.Mutex.Unlock()
+
+	if version < h.minProtocolVersion() {
+		h.refuseVersion(client, version, "a hello message is required before any other message")
+		return false
+	}
+
+	h.Metrics.ClientProtocols.Add("v"+strconv.Itoa(version), 1)
+	if version == ProtocolVersionLegacy {
+		client.Logger().Info("Client is using the deprecated legacy protocol")
+	}
+	return true
+}
+
+// refuseVersion tells a client its protocol version isn't supported and
+// closes its connection
+func (h *Hub) refuseVersion(client *common.Client, version int, reason string) {
+	client.Logger().Warn("Refused unsupported protocol version", "protocolVersion", version, "reason", reason)
+
+	unsupportedMsg := types.UnsupportedVersionMessage{
+		Type:               types.MessageTypeUnsupported,
+		ProtocolVersion:    version,
+		MinProtocolVersion: h.minProtocolVersion(),
+		MaxProtocolVersion: ProtocolVersion,
+		Reason:             reason,
+	}
+
+	select {
+	case client.SendChan <- unsupportedMsg:
+	default:
+		client.Logger().Warn("Failed to send unsupported version message")
+	}
+
+	h.Disconnect(client, CloseUnsupportedVersion, "unsupported protocol version")
+}
@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+// queuedClient is a client waiting for a free slot in a full room
+type queuedClient struct {
+	client   *common.Client
+	playerID string
+	priority bool // Whether the client presented a priority token
+}
+
+// activePlayersLocked returns the number of players holding a slot, the
+// presence mutex must be held
+func (h *Hub) activePlayersLocked() int {
+	count := 0
+	for _, p := range h.presence {
+		if p.active() {
+			count++
+		}
+	}
+	return count
+}
+
+// enqueueLocked adds a client to the join queue and returns its position,
+// counting from one, the presence mutex must be held
+//
+// Clients with a priority token wait behind the others who have one but
+// ahead of everyone else, otherwise the queue is first come, first served.
+func (h *Hub) enqueueLocked(client *common.Client, playerID string, priority bool) int {
+	position := len(h.queue)
+	if priority {
+		position = 0
+		for position < len(h.queue) && h.queue[position].priority {
+			position++
+		}
+	}
+
+	h.queue = append(h.queue, nil)
+	copy(h.queue[position+1:], h.queue[position:])
+	h.queue[position] = &queuedClient{client: client, playerID: playerID, priority: priority}
+	client.Queued.Store(true)
+
+	client.Logger().Info("Room is full, queued player", "player", playerID, "position", position+1, "priority", priority)
+
+	// Everyone skipped by a priority client moved back one place
+	h.sendQueuePositionsLocked(position + 1)
+	return position + 1
+}
+
+// dequeueLocked removes a client from the join queue if it is waiting in
+// it, the presence mutex must be held
+func (h *Hub) dequeueLocked(client *common.Client) {
+	if !client.Queued.Load() {
+		return
+	}
+	for i, queued := range h.queue {
+		if queued.client == client {
+			h.queue = append(h.queue[:i], h.queue[i+1:]...)
+			client.Queued.Store(false)
+			h.sendQueuePositionsLocked(i)
+			return
+		}
+	}
+}
+
+// promoteLocked lets queued clients join while the room has free slots, the
+// presence mutex must be held
+func (h *Hub) promoteLocked() {
+	promoted := 0
+	for len(h.queue) > 0 && (h.maxPlayers <= 0 || h.activePlayersLocked() < h.maxPlayers) {
+		queued := h.queue[0]
+		h.queue = h.queue[1:]
+		queued.client.Queued.Store(false)
+		promoted++
+
+		queued.client.Logger().Info("Promoted player from the join queue")
+		token := h.joinLocked(queued.client, queued.playerID)
+		h.welcome(queued.client, queued.playerID, token)
+		h.sendRosterLocked(queued.client)
+	}
+
+	if promoted > 0 {
+		h.sendQueuePositionsLocked(0)
+	}
+}
+
+// sendQueuePositionsLocked tells the queued clients from the given index on
+// their position, the presence mutex must be held
+func (h *Hub) sendQueuePositionsLocked(from int) {
+	for i := from; i < len(h.queue); i++ {
+		h.sendQueuePosition(h.queue[i].client, i+1)
+	}
+}
+
+// SendQueuePositionToClient tells a queued client its position in the join
+// queue
+func (h *Hub) SendQueuePositionToClient(client *common.Client) {
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	for i, queued := range h.queue {
+		if queued.client == client {
+			h.sendQueuePosition(client, i+1)
+			return
+		}
+	}
+}
+
+// sendQueuePosition sends a queued client its position
+func (h *Hub) sendQueuePosition(client *common.Client, position int) {
+	select {
+	case client.SendChan <- types.QueuePositionMessage{
+		Type:        types.MessageTypeQueuePosition,
+		Position:    position,
+		QueueLength: len(h.queue),
+	}:
+		client.Logger().Debug("Sent queue position", "position", position)
+	default:
+		client.Logger().Warn("Failed to send queue position")
+	}
+}
+
+// setCapacity updates the player limit and priority tokens, letting queued
+// clients in if the limit was raised
+func (h *Hub) setCapacity(maxPlayers int, priorityTokens []string) {
+	h.presenceMutex.Lock()
+	defer h.presenceMutex.Unlock()
+
+	if maxPlayers != h.maxPlayers {
+		h.maxPlayers = maxPlayers
+		h.logger.Info("Updated player limit", "maxPlayers", maxPlayers)
+	}
+
+	h.priorityTokens = tokenSet(priorityTokens)
+
+	h.promoteLocked()
+}
+
+// tokenSet builds the set of priority tokens, ignoring empty ones
+func tokenSet(tokens []string) map[string]bool {
+	set := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		if token != "" {
+			set[token] = true
+		}
+	}
+	return set
+}
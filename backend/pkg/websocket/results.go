@@ -0,0 +1,285 @@
+package websocket
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/matches"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/profiles"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+)
+
+// Most scores a result report may carry
+const maxReportScores = 1024
+
+// The server doesn't simulate the match, so its result is decided by the
+// players: once the match ends, every player's simulation reports the final
+// scores it computed, and the result is recorded as soon as a majority of
+// the players in the match agree on it. If the results phase ends without a
+// majority, the result reported by the most players is recorded instead and
+// marked unconfirmed, and a match nobody reported a result for isn't recorded
+// at all.
+
+// ballot collects the result reports of the match that just ended
+type ballot struct {
+	voters    map[string]bool                // Players in the match and the room when it ended
+	votes     map[string]string              // Key of the result each player reported
+	results   map[string][]types.PlayerScore // Scores of each reported result by its key
+	startedAt time.Time
+	endedAt   time.Time
+	ticks     uint64
+}
+
+// quorum is the number of players who must agree on a result
+func (b *ballot) quorum() int {
+	return len(b.voters)/2 + 1
+}
+
+// Matches returns the hub's results history
+func (h *Hub) Matches() *matches.Store {
+	return h.matchList
+}
+
+// Profiles returns the hub's player store
+func (h *Hub) Profiles() *profiles.Store {
+	return h.profileList
+}
+
+// rating returns a player's skill rating, rounded for clients
+func (h *Hub) rating(playerID string) int {
+	return int(math.Round(h.profileList.Rating(playerID)))
+}
+
+// openBallot starts collecting result reports from the players in the match,
+// from within Run when the match ends
+//
+// The players' simulations only know the players who sent an input during
+// the match, so only those who are still in the room get a vote and a place
+// in the rankings.
+func (h *Hub) openBallot() {
+	h.InputMutex.Lock()
+	ticks := h.CurrentTick
+	played := make(map[string]bool)
+	for _, tick := range h.TickHistory {
+		for _, input := range tick.Inputs {
+			played[input.PlayerID] = true
+		}
+	}
+	h.InputMutex.Unlock()
+
+	h.presenceMutex.Lock()
+	voters := make(map[string]bool, len(played))
+	for playerID := range played {
+		if p, ok := h.presence[playerID]; ok && p.active() {
+			voters[playerID] = true
+		}
+	}
+	h.presenceMutex.Unlock()
+
+	h.resultsMutex.Lock()
+	h.ballot = &ballot{
+		voters:    voters,
+		votes:     make(map[string]string),
+		results:   make(map[string][]types.PlayerScore),
+		startedAt: h.matchStartedAt,
+		endedAt:   time.Now(),
+		ticks:     ticks,
+	}
+	h.resultsMutex.Unlock()
+
+	h.logger.Info("Collecting match results", "players", len(voters))
+}
+
+// ReportResult counts a player's report of the final scores, recording the
+// result once a majority of the players agree on it
+func (h *Hub) ReportResult(client *common.Client, report types.MatchResultMessage) {
+	if client.Spectator.Load() || client.Queued.Load() {
+		client.Logger().Debug("Ignored match result from a client not in the match")
+		return
+	}
+	if len(report.Scores) > maxReportScores {
+		client.Logger().Warn("Ignored match result with too many scores", "scores", len(report.Scores))
+		return
+	}
+
+	h.presenceMutex.Lock()
+	playerID, joined := h.joined[client]
+	h.presenceMutex.Unlock()
+	if !joined {
+		client.Logger().Debug("Ignored match result from a client that hasn't joined")
+		return
+	}
+
+	h.resultsMutex.Lock()
+	b := h.ballot
+	if b == nil || !b.voters[playerID] {
+		h.resultsMutex.Unlock()
+		client.Logger().Debug("Ignored match result outside of a vote", "player", playerID)
+		return
+	}
+	if _, voted := b.votes[playerID]; voted {
+		h.resultsMutex.Unlock()
+		client.Logger().Debug("Ignored repeated match result", "player", playerID)
+		return
+	}
+	scores, key, ok := normalizeScores(report.Scores, b.voters)
+	if !ok {
+		h.resultsMutex.Unlock()
+		client.Logger().Warn("Ignored invalid match result", "player", playerID)
+		return
+	}
+
+	b.votes[playerID] = key
+	b.results[key] = scores
+	agreed := b.count(key)
+	client.Logger().Debug("Counted match result", "player", playerID, "agreed", agreed, "quorum", b.quorum())
+	if agreed < b.quorum() {
+		h.resultsMutex.Unlock()
+		return
+	}
+	h.ballot = nil
+	h.resultsMutex.Unlock()
+
+	h.recordResult(b, key, true)
+}
+
+// closeBallot records the result reported by the most players if no
+// majority agreed on one before the results phase ended, if any were reported
+func (h *Hub) closeBallot() {
+	h.resultsMutex.Lock()
+	b := h.ballot
+	h.ballot = nil
+	h.resultsMutex.Unlock()
+	if b == nil {
+		return
+	}
+	if len(b.votes) == 0 {
+		h.logger.Info("No match results reported, nothing recorded", "players", len(b.voters))
+		return
+	}
+
+	// Keys are compared too, so ties are broken the same way every time
+	best, bestCount := "", 0
+	for key := range b.results {
+		if count := b.count(key); count > bestCount || count == bestCount && key < best {
+			best, bestCount = key, count
+		}
+	}
+	h.recordResult(b, best, false)
+}
+
+// count returns the number of players who reported the result with a key
+func (b *ballot) count(key string) int {
+	count := 0
+	for _, vote := range b.votes {
+		if vote == key {
+			count++
+		}
+	}
+	return count
+}
+
+// recordResult ranks the players by the scores of a result, adds it to the
+// results history and tells every client
+func (h *Hub) recordResult(b *ballot, key string, confirmed bool) {
+	result := types.MatchResult{
+		Room:      h.room,
+		StartedAt: b.startedAt,
+		EndedAt:   b.endedAt,
+		Ticks:     b.ticks,
+		Rankings:  make([]types.Ranking, 0, len(b.results[key])),
+		Players:   len(b.voters),
+		Reports:   len(b.votes),
+		Agreed:    b.count(key),
+		Confirmed: confirmed,
+	}
+
+	scores := b.results[key]
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+
+	h.DisplayNamesMutex.Lock()
+	for i, score := range scores {
+		rank := i + 1
+		if i > 0 && score.Score == scores[i-1].Score {
+			rank = result.Rankings[i-1].Rank
+		}
+		result.Rankings = append(result.Rankings, types.Ranking{
+			Rank:         rank,
+			PlayerID:     score.PlayerID,
+			DisplayName:  h.DisplayNames[score.PlayerID],
+			Score:        score.Score,
+			BombsDropped: score.BombsDropped,
+			HitsTaken:    score.HitsTaken,
+		})
+	}
+	h.DisplayNamesMutex.Unlock()
+
+	// Like the game itself, a tie or a match nobody scored in has no winner
+	if len(scores) > 0 && scores[0].Score > 0 && (len(scores) == 1 || scores[1].Score < scores[0].Score) {
+		result.Winner = scores[0].PlayerID
+	}
+
+	stored, err := h.matchList.Add(result)
+	if err != nil {
+		h.logger.Error("Failed to record match result", "confirmed", confirmed, "error", err)
+		return
+	}
+	result = stored
+
+	h.logger.Info("Recorded match result", "match", result.ID, "winner", result.Winner, "confirmed", confirmed,
+		"players", result.Players, "reports", result.Reports, "agreed", result.Agreed)
+	h.Metrics.MatchResults.Add(resultLabel(confirmed), 1)
+
+	// Only results the players agreed on count towards their statistics
+	if confirmed {
+		if err := h.profileList.Record(result); err != nil {
+			h.logger.Error("Failed to update player profiles", "match", result.ID, "error", err)
+		}
+	}
+
+	select {
+	case h.Broadcast <- types.MatchResultsMessage{Type: types.MessageTypeMatchResults, Result: result}:
+	default:
+		h.Metrics.HubBroadcastDrops.Add(1)
+		h.logger.Warn("Failed to broadcast match result", "match", result.ID)
+	}
+}
+
+// resultLabel is the metrics label of a confirmed or unconfirmed result
+func resultLabel(confirmed bool) string {
+	if confirmed {
+		return "confirmed"
+	}
+	return "unconfirmed"
+}
+
+// normalizeScores keeps the reported scores of the voters, sorted by player
+// ID, and returns them with a key that is the same for every report of the
+// same scores. Scores of players who left are dropped, and reports that miss
+// or repeat a voter or have negative counts are refused.
+func normalizeScores(reported []types.PlayerScore, voters map[string]bool) ([]types.PlayerScore, string, bool) {
+	scores := make([]types.PlayerScore, 0, len(voters))
+	seen := make(map[string]bool, len(reported))
+	for _, score := range reported {
+		if score.PlayerID == "" || score.Score < 0 || score.BombsDropped < 0 || score.HitsTaken < 0 || seen[score.PlayerID] {
+			return nil, "", false
+		}
+		seen[score.PlayerID] = true
+		if voters[score.PlayerID] {
+			scores = append(scores, score)
+		}
+	}
+	if len(scores) != len(voters) {
+		return nil, "", false
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].PlayerID < scores[j].PlayerID })
+
+	key, err := json.Marshal(scores)
+	if err != nil {
+		return nil, "", false
+	}
+	return scores, string(key), true
+}
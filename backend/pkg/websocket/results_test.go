@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+func TestNormalizeScores(t *testing.T) {
+	voters := map[string]bool{"a": true, "b": true}
+
+	tests := []struct {
+		name     string
+		reported []types.PlayerScore
+		want     []types.PlayerScore
+		ok       bool
+	}{
+		{
+			name:     "sorted by player",
+			reported: []types.PlayerScore{{PlayerID: "b", Score: 3}, {PlayerID: "a", Score: 5, HitsTaken: 1}},
+			want:     []types.PlayerScore{{PlayerID: "a", Score: 5, HitsTaken: 1}, {PlayerID: "b", Score: 3}},
+			ok:       true,
+		},
+		{
+			name:     "players outside the match dropped",
+			reported: []types.PlayerScore{{PlayerID: "a", Score: 5}, {PlayerID: "x", Score: 99}, {PlayerID: "b", Score: 3}},
+			want:     []types.PlayerScore{{PlayerID: "a", Score: 5}, {PlayerID: "b", Score: 3}},
+			ok:       true,
+		},
+		{
+			name:     "missing a player",
+			reported: []types.PlayerScore{{PlayerID: "a", Score: 5}},
+		},
+		{
+			name:     "missing a player padded with others",
+			reported: []types.PlayerScore{{PlayerID: "a", Score: 5}, {PlayerID: "x", Score: 1}},
+		},
+		{
+			name:     "repeated player",
+			reported: []types.PlayerScore{{PlayerID: "a", Score: 5}, {PlayerID: "b", Score: 3}, {PlayerID: "a", Score: 1}},
+		},
+		{
+			name:     "empty player ID",
+			reported: []types.PlayerScore{{PlayerID: "a"}, {PlayerID: "b"}, {PlayerID: ""}},
+		},
+		{
+			name:     "negative score",
+			reported: []types.PlayerScore{{PlayerID: "a", Score: -1}, {PlayerID: "b"}},
+		},
+		{
+			name:     "negative bombs",
+			reported: []types.PlayerScore{{PlayerID: "a", BombsDropped: -1}, {PlayerID: "b"}},
+		},
+		{
+			name:     "negative hits",
+			reported: []types.PlayerScore{{PlayerID: "a"}, {PlayerID: "b", HitsTaken: -1}},
+		},
+		{
+			name: "nothing reported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, key, ok := normalizeScores(tt.reported, voters)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scores = %+v, want %+v", got, tt.want)
+			}
+			if ok == (key == "") {
+				t.Errorf("key = %q with ok %v", key, ok)
+			}
+		})
+	}
+}
+
+func TestNormalizeScoresKey(t *testing.T) {
+	voters := map[string]bool{"a": true, "b": true}
+
+	_, first, _ := normalizeScores([]types.PlayerScore{{PlayerID: "a", Score: 5}, {PlayerID: "b", Score: 3}}, voters)
+	_, reordered, _ := normalizeScores([]types.PlayerScore{{PlayerID: "b", Score: 3}, {PlayerID: "a", Score: 5}}, voters)
+	_, extra, _ := normalizeScores([]types.PlayerScore{{PlayerID: "b", Score: 3}, {PlayerID: "x"}, {PlayerID: "a", Score: 5}}, voters)
+	_, different, _ := normalizeScores([]types.PlayerScore{{PlayerID: "a", Score: 5}, {PlayerID: "b", Score: 4}}, voters)
+
+	if first != reordered || first != extra {
+		t.Errorf("the same scores gave different keys: %q, %q, %q", first, reordered, extra)
+	}
+	if first == different {
+		t.Errorf("different scores gave the same key %q", first)
+	}
+}
+
+func TestCloseBallot(t *testing.T) {
+	tests := []struct {
+		name         string
+		votes        map[string]string
+		wantRecorded bool
+		wantRankings int
+	}{
+		{name: "nothing reported", votes: map[string]string{}},
+		{name: "reported without a majority", votes: map[string]string{"a": "key"}, wantRecorded: true, wantRankings: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub()
+			b := &ballot{
+				voters:  map[string]bool{"a": true, "b": true, "c": true},
+				votes:   tt.votes,
+				results: make(map[string][]types.PlayerScore),
+			}
+			for _, key := range tt.votes {
+				b.results[key] = []types.PlayerScore{{PlayerID: "a", Score: 5}, {PlayerID: "b", Score: 3}}
+			}
+			hub.ballot = b
+
+			hub.closeBallot()
+
+			if hub.ballot != nil {
+				t.Error("ballot still open")
+			}
+			if recorded := hub.Matches().Len() == 1; recorded != tt.wantRecorded {
+				t.Fatalf("recorded = %v, want %v", recorded, tt.wantRecorded)
+			}
+			select {
+			case message := <-hub.Broadcast:
+				if !tt.wantRecorded {
+					t.Errorf("broadcast %s for a match nobody reported", message.GetType())
+				}
+			default:
+				if tt.wantRecorded {
+					t.Error("recorded result wasn't broadcast")
+				}
+			}
+			if !tt.wantRecorded {
+				return
+			}
+
+			result := hub.Matches().List(0, 1)[0]
+			if len(result.Rankings) != tt.wantRankings {
+				t.Errorf("recorded %d rankings, want %d", len(result.Rankings), tt.wantRankings)
+			}
+			if result.Confirmed {
+				t.Error("result without a majority recorded as confirmed")
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/websocket/common"
+	"github.com/gorilla/websocket"
+)
+
+// spectateRequest asks Run to turn a player into a spectator
+type spectateRequest struct {
+	client *common.Client
+	result chan bool
+}
+
+// Spectate turns a connected player into a spectator, it returns false if
+// the spectator limit has been reached
+func (h *Hub) Spectate(client *common.Client) bool {
+	request := spectateRequest{client: client, result: make(chan bool, 1)}
+	select {
+	case h.spectate <- request:
+		return <-request.result
+	case <-h.done:
+		return false
+	}
+}
+
+// countRoles counts the connected players and spectators, ClientsMutex must be held
+func (h *Hub) countRoles() (players int, spectators int) {
+	for client := range h.Clients {
+		if client.Spectator.Load() {
+			spectators++
+		} else {
+			players++
+		}
+	}
+	return players, spectators
+}
+
+// makeSpectator turns a player into a spectator from within Run, suspending
+// the match if it was the last player
+func (h *Hub) makeSpectator(client *common.Client) bool {
+	h.ClientsMutex.Lock()
+	if client.Spectator.Load() {
+		h.ClientsMutex.Unlock()
+		return true
+	}
+
+	_, spectatorCount := h.countRoles()
+	if h.maxSpectators > 0 && spectatorCount >= h.maxSpectators {
+		h.ClientsMutex.Unlock()
+		client.Logger().Info("Spectator limit reached, client stays a player", "maxSpectators", h.maxSpectators)
+		return false
+	}
+
+	client.Spectator.Store(true)
+	playerCount, spectatorCount := h.countRoles()
+	h.ClientsMutex.Unlock()
+
+	client.Logger().Info("Client became a spectator", "players", playerCount, "spectators", spectatorCount)
+
+	h.playersChanged()
+	return true
+}
+
+// refuseSpectator closes the connection of a spectator that connected while
+// the spectator limit was reached, the client was never registered
+func (h *Hub) refuseSpectator(client *common.Client) {
+	client.Logger().Info("Spectator limit reached, refusing spectator", "maxSpectators", h.maxSpectators)
+	h.Metrics.RejectedUpgrades.Add("spectators", 1)
+
+	h.sendError(client, types.ErrorCodeSpectatorsFull, "the match has no room for more spectators")
+
+	client.CloseCode = websocket.CloseTryAgainLater
+	client.CloseReason = "spectator limit reached"
+	close(client.SendChan)
+}
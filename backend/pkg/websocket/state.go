@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/atomicfile"
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// MatchState is the state of a running match, saved to disk on shutdown so
+// the match can be replayed or resumed when the server starts again
+type MatchState struct {
+	SavedAt      time.Time           `json:"savedAt"`
+	Room         string              `json:"room"`
+	TickInterval int                 `json:"tickInterval"`
+	MaxTicks     uint64              `json:"maxTicks"`
+	CurrentTick  uint64              `json:"currentTick"`
+	History      []types.GameTick    `json:"history"`
+	DisplayNames map[string]string   `json:"displayNames"`
+	Chat         []types.ChatMessage `json:"chat"`
+}
+
+// SaveState writes the current match state to path
+//
+// The file is written to a temporary file first and renamed into place, so
+// an interrupted save never leaves a truncated state file behind.
+func (h *Hub) SaveState(path string) error {
+	h.InputMutex.Lock()
+	state := MatchState{
+		SavedAt:      time.Now(),
+		Room:         h.room,
+		TickInterval: h.tickInterval,
+		MaxTicks:     h.maxHistorySize,
+		CurrentTick:  h.CurrentTick,
+		History:      h.TickHistory,
+	}
+	h.InputMutex.Unlock()
+
+	state.Chat = h.chat.History()
+
+	h.DisplayNamesMutex.Lock()
+	state.DisplayNames = make(map[string]string, len(h.DisplayNames))
+	for id, name := range h.DisplayNames {
+		state.DisplayNames[id] = name
+	}
+	h.DisplayNamesMutex.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error marshalling match state: %w", err)
+	}
+
+	if err := atomicfile.Write(path, data); err != nil {
+		return fmt.Errorf("error saving state file: %w", err)
+	}
+
+	h.logger.Info("Saved match state", "path", path, "historyTicks", len(state.History))
+	return nil
+}
+
+// LoadState restores a match saved by SaveState, it must be called before Run
+//
+// A missing file is not an error. A state saved with a different tick
+// interval or match length is ignored, since replaying it would not produce
+// the same match.
+func (h *Hub) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading state file: %w", err)
+	}
+
+	var state MatchState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("error decoding state file: %w", err)
+	}
+
+	if state.TickInterval != h.tickInterval || state.MaxTicks != h.maxHistorySize {
+		h.logger.Warn("Ignoring saved match state with different game settings",
+			"path", path, "tickInterval", state.TickInterval, "maxTicks", state.MaxTicks)
+		return nil
+	}
+
+	h.InputMutex.Lock()
+	h.CurrentTick = state.CurrentTick
+	h.tick.Store(state.CurrentTick)
+	h.TickHistory = append(make([]types.GameTick, 0, h.historyCapacity()), state.History...)
+	if state.CurrentTick > 0 {
+		// The match already announced its seed
+		h.CurrentEvents = nil
+	}
+	h.InputMutex.Unlock()
+
+	h.DisplayNamesMutex.Lock()
+	for id, name := range state.DisplayNames {
+		h.DisplayNames[id] = name
+	}
+	h.DisplayNamesMutex.Unlock()
+
+	h.chat.Restore(state.Chat)
+
+	h.logger.Info("Restored match state", "path", path, "savedAt", state.SavedAt,
+		"historyTicks", len(state.History), "chatMessages", len(state.Chat))
+	return nil
+}
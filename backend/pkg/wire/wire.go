@@ -0,0 +1,369 @@
+// Package wire implements the compact binary encoding of game ticks sent to
+// clients that negotiate the "binary" capability.
+//
+// Every frame starts with a kind byte. Numbers are unsigned varints as
+// produced by encoding/binary.AppendUvarint, strings are a varint length
+// followed by UTF-8 bytes.
+//
+// Players are identified by their index in a per-match player table instead
+// of their ID. A tick frame defines the players that appear in it for the
+// first time, so a client that has seen every tick since joining always
+// knows every index. Defining an index again always gives it the same ID.
+//
+// A player table frame carries the whole table and replaces the decoder's.
+// One is sent to clients joining mid-match, and an empty one to every binary
+// client when a new match starts, which is the only time indexes are reused.
+// Connect messages say nothing about the table, as they are also sent to
+// clients joining mid-match.
+//
+// Server events follow the inputs of a tick, each with its kind byte, the
+// index of its player plus one, or zero for events without a player, and its
+// value. Decoders written before events existed stop reading after the
+// inputs and keep working.
+//
+//	tick frame:    0x01 tick:uvarint defs:players inputs:uvarint (index<<5|flags:uvarint)* events
+//	player table:  0x02 defs:players
+//	players:       count:uvarint (index:uvarint id:string)*
+//	events:        count:uvarint (kind:byte player:uvarint value:string)*
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+// Frame kinds, the first byte of every frame
+const (
+	FrameTick    byte = 0x01
+	FramePlayers byte = 0x02
+)
+
+// Input flags, packed into the low five bits of each encoded input
+const (
+	FlagUp uint64 = 1 << iota
+	FlagDown
+	FlagLeft
+	FlagRight
+	FlagPlaceBlob
+
+	flagBits = 5
+	flagMask = 1<<flagBits - 1
+)
+
+// Event kinds, the first byte of each encoded event
+const (
+	EventJoin byte = iota + 1
+	EventLeave
+	EventNameChange
+	EventAdmin
+	EventSeed
+	EventChat
+)
+
+// eventKinds maps the event kinds of the tick stream to their byte
+var eventKinds = map[types.EventKind]byte{
+	types.EventJoin:       EventJoin,
+	types.EventLeave:      EventLeave,
+	types.EventNameChange: EventNameChange,
+	types.EventAdmin:      EventAdmin,
+	types.EventSeed:       EventSeed,
+	types.EventChat:       EventChat,
+}
+
+// ErrTruncated is returned when a frame ends in the middle of a value
+var ErrTruncated = errors.New("truncated frame")
+
+// PlayerTable assigns each player of a match a small index, in the order
+// they first appear
+type PlayerTable struct {
+	index map[string]uint64
+	ids   []string
+}
+
+// NewPlayerTable creates an empty player table
+func NewPlayerTable() *PlayerTable {
+	return &PlayerTable{index: make(map[string]uint64)}
+}
+
+// Index returns the player's index, assigning the next free one and
+// reporting it as new if the player hasn't been seen before
+func (t *PlayerTable) Index(playerID string) (uint64, bool) {
+	if index, ok := t.index[playerID]; ok {
+		return index, false
+	}
+	index := uint64(len(t.ids))
+	t.index[playerID] = index
+	t.ids = append(t.ids, playerID)
+	return index, true
+}
+
+// Players returns a copy of the player IDs in index order
+func (t *PlayerTable) Players() []string {
+	return append([]string(nil), t.ids...)
+}
+
+// Flags packs an input's buttons into the five input flag bits
+func Flags(input types.PlayerInput) uint64 {
+	var flags uint64
+	if input.Up {
+		flags |= FlagUp
+	}
+	if input.Down {
+		flags |= FlagDown
+	}
+	if input.Left {
+		flags |= FlagLeft
+	}
+	if input.Right {
+		flags |= FlagRight
+	}
+	if input.PlaceBlob {
+		flags |= FlagPlaceBlob
+	}
+	return flags
+}
+
+// EncodeTick appends the tick frame for tick to buf, assigning indexes to
+// players missing from the table and defining them in the frame
+func EncodeTick(buf []byte, tick types.GameTick, table *PlayerTable) []byte {
+	indexes := make([]uint64, len(tick.Inputs))
+	newPlayers := 0
+	for i, input := range tick.Inputs {
+		index, isNew := table.Index(input.PlayerID)
+		indexes[i] = index
+		if isNew {
+			newPlayers++
+		}
+	}
+	eventPlayers := make([]uint64, len(tick.Events))
+	for i, event := range tick.Events {
+		if event.PlayerID == "" {
+			continue
+		}
+		index, isNew := table.Index(event.PlayerID)
+		eventPlayers[i] = index + 1
+		if isNew {
+			newPlayers++
+		}
+	}
+
+	buf = append(buf, FrameTick)
+	buf = binary.AppendUvarint(buf, tick.Tick)
+
+	// Players are added to the table in the order they appear, so the new
+	// ones are the last entries
+	buf = binary.AppendUvarint(buf, uint64(newPlayers))
+	for index := len(table.ids) - newPlayers; index < len(table.ids); index++ {
+		buf = appendPlayer(buf, uint64(index), table.ids[index])
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(tick.Inputs)))
+	for i, input := range tick.Inputs {
+		buf = binary.AppendUvarint(buf, indexes[i]<<flagBits|Flags(input))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(tick.Events)))
+	for i, event := range tick.Events {
+		buf = append(buf, eventKinds[event.Kind])
+		buf = binary.AppendUvarint(buf, eventPlayers[i])
+		buf = binary.AppendUvarint(buf, uint64(len(event.Value)))
+		buf = append(buf, event.Value...)
+	}
+	return buf
+}
+
+// EncodePlayers appends a player table frame for the given player IDs, in
+// index order, to buf
+func EncodePlayers(buf []byte, players []string) []byte {
+	buf = append(buf, FramePlayers)
+	buf = binary.AppendUvarint(buf, uint64(len(players)))
+	for index, playerID := range players {
+		buf = appendPlayer(buf, uint64(index), playerID)
+	}
+	return buf
+}
+
+// appendPlayer appends a single player definition
+func appendPlayer(buf []byte, index uint64, playerID string) []byte {
+	buf = binary.AppendUvarint(buf, index)
+	buf = binary.AppendUvarint(buf, uint64(len(playerID)))
+	return append(buf, playerID...)
+}
+
+// Decoder decodes the frames sent on one connection, keeping track of the
+// player table they define
+type Decoder struct {
+	Players []string
+}
+
+// Reset clears the player table, as decoding a player table frame does
+func (d *Decoder) Reset() {
+	d.Players = d.Players[:0]
+}
+
+// Decode decodes a frame and updates the player table, it returns the tick
+// carried by a tick frame or nil for a player table frame
+func (d *Decoder) Decode(frame []byte) (*types.GameTick, error) {
+	if len(frame) == 0 {
+		return nil, ErrTruncated
+	}
+	r := reader{data: frame[1:]}
+
+	switch frame[0] {
+	case FramePlayers:
+		d.Reset()
+		if err := d.readPlayers(&r); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	case FrameTick:
+		tick := &types.GameTick{Tick: r.uvarint()}
+		if err := d.readPlayers(&r); err != nil {
+			return nil, err
+		}
+
+		count := r.uvarint()
+		if r.err == nil && count > uint64(len(r.data)) {
+			return nil, ErrTruncated
+		}
+		tick.Inputs = make([]types.PlayerInput, 0, count)
+		for range count {
+			value := r.uvarint()
+			if r.err != nil {
+				return nil, r.err
+			}
+
+			index := value >> flagBits
+			if index >= uint64(len(d.Players)) {
+				return nil, fmt.Errorf("input for undefined player index %d", index)
+			}
+			flags := value & flagMask
+			tick.Inputs = append(tick.Inputs, types.PlayerInput{
+				PlayerID:  d.Players[index],
+				Up:        flags&FlagUp != 0,
+				Down:      flags&FlagDown != 0,
+				Left:      flags&FlagLeft != 0,
+				Right:     flags&FlagRight != 0,
+				PlaceBlob: flags&FlagPlaceBlob != 0,
+			})
+		}
+
+		// Frames from before events existed end after the inputs
+		if r.err != nil || len(r.data) == 0 {
+			return tick, r.err
+		}
+		if err := d.readEvents(&r, tick); err != nil {
+			return nil, err
+		}
+		return tick, nil
+
+	default:
+		return nil, fmt.Errorf("unknown frame kind 0x%02x", frame[0])
+	}
+}
+
+// readEvents reads the events of a tick
+func (d *Decoder) readEvents(r *reader, tick *types.GameTick) error {
+	count := r.uvarint()
+	if r.err == nil && count > uint64(len(r.data)) {
+		return ErrTruncated
+	}
+	for range count {
+		kind := r.byte()
+		player := r.uvarint()
+		value := r.string()
+		if r.err != nil {
+			return r.err
+		}
+
+		event := types.GameEvent{Value: value}
+		for eventKind, b := range eventKinds {
+			if b == kind {
+				event.Kind = eventKind
+			}
+		}
+		if event.Kind == "" {
+			return fmt.Errorf("unknown event kind 0x%02x", kind)
+		}
+		if player > 0 {
+			if player > uint64(len(d.Players)) {
+				return fmt.Errorf("event for undefined player index %d", player-1)
+			}
+			event.PlayerID = d.Players[player-1]
+		}
+		tick.Events = append(tick.Events, event)
+	}
+	return r.err
+}
+
+// readPlayers reads player definitions into the table
+func (d *Decoder) readPlayers(r *reader) error {
+	count := r.uvarint()
+	for range count {
+		index := r.uvarint()
+		playerID := r.string()
+		if r.err != nil {
+			return r.err
+		}
+
+		if index > uint64(len(d.Players)) {
+			return fmt.Errorf("player index %d defined out of order", index)
+		}
+		if index == uint64(len(d.Players)) {
+			d.Players = append(d.Players, playerID)
+		} else {
+			d.Players[index] = playerID
+		}
+	}
+	return r.err
+}
+
+// reader reads values from a frame, remembering the first error
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = ErrTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = ErrTruncated
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *reader) string() string {
+	length := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if length > uint64(len(r.data)) {
+		r.err = ErrTruncated
+		return ""
+	}
+	s := string(r.data[:length])
+	r.data = r.data[length:]
+	return s
+}
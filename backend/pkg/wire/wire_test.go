@@ -0,0 +1,184 @@
+package wire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/chrisfarms/vibes/blobberman/backend/pkg/types"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		known []string // Players the decoder got from a player table first
+		ticks []types.GameTick
+	}{
+		{
+			name:  "empty tick",
+			ticks: []types.GameTick{{Tick: 0}},
+		},
+		{
+			name:  "known players",
+			known: []string{"alice", "bob"},
+			ticks: []types.GameTick{{Tick: 300, Inputs: []types.PlayerInput{
+				{PlayerID: "bob", Up: true, PlaceBlob: true},
+				{PlayerID: "alice", Down: true, Left: true, Right: true},
+			}}},
+		},
+		{
+			name: "players defined by the tick",
+			ticks: []types.GameTick{
+				{Tick: 1, Inputs: []types.PlayerInput{{PlayerID: "alice", Up: true}}},
+				{Tick: 2, Inputs: []types.PlayerInput{{PlayerID: "bob"}, {PlayerID: "alice", Left: true}}},
+			},
+		},
+		{
+			name:  "every event kind",
+			known: []string{"alice"},
+			ticks: []types.GameTick{{Tick: 7, Events: []types.GameEvent{
+				{Kind: types.EventSeed, Value: "1234567890"},
+				{Kind: types.EventJoin, PlayerID: "alice", Value: "Blobby"},
+				{Kind: types.EventNameChange, PlayerID: "alice", Value: "Blobby McBlobface"},
+				{Kind: types.EventAdmin, Value: "reload"},
+				{Kind: types.EventLeave, PlayerID: "carol"},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewPlayerTable()
+			for _, playerID := range tt.known {
+				table.Index(playerID)
+			}
+			decoder := &Decoder{}
+			if _, err := decoder.Decode(EncodePlayers(nil, table.Players())); err != nil {
+				t.Fatalf("decoding player table: %v", err)
+			}
+
+			for _, tick := range tt.ticks {
+				decoded, err := decoder.Decode(EncodeTick(nil, tick, table))
+				if err != nil {
+					t.Fatalf("decoding tick %d: %v", tick.Tick, err)
+				}
+				if len(decoded.Inputs) == 0 && tick.Inputs == nil {
+					decoded.Inputs = nil
+				}
+				if !reflect.DeepEqual(*decoded, tick) {
+					t.Errorf("tick %d decoded as %+v, want %+v", tick.Tick, *decoded, tick)
+				}
+			}
+			if !reflect.DeepEqual(decoder.Players, table.Players()) {
+				t.Errorf("decoder players are %v, want %v", decoder.Players, table.Players())
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	table := NewPlayerTable()
+	table.Index("alice")
+	tick := types.GameTick{Tick: 5, Inputs: []types.PlayerInput{{PlayerID: "alice", Up: true}}}
+	frame := EncodeTick(nil, tick, table)
+
+	if _, err := (&Decoder{}).Decode(frame); err == nil {
+		t.Error("decoded an input for a player missing from the table")
+	}
+	if _, err := (&Decoder{Players: []string{"alice"}}).Decode(frame[:len(frame)-2]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("decoding a truncated frame returned %v, want %v", err, ErrTruncated)
+	}
+	if _, err := (&Decoder{}).Decode([]byte{0x7f}); err == nil {
+		t.Error("decoded an unknown frame kind")
+	}
+}
+
+func TestPlayerTableStartsOver(t *testing.T) {
+	decoder := &Decoder{}
+	table := NewPlayerTable()
+	table.Index("alice")
+	table.Index("bob")
+	if _, err := decoder.Decode(EncodePlayers(nil, table.Players())); err != nil {
+		t.Fatalf("decoding player table: %v", err)
+	}
+	if _, err := decoder.Decode(EncodeTick(nil, types.GameTick{Tick: 9, Inputs: []types.PlayerInput{{PlayerID: "carol"}}}, table)); err != nil {
+		t.Fatalf("decoding tick: %v", err)
+	}
+
+	// A new match starts with an empty table and reuses the indexes
+	table = NewPlayerTable()
+	if _, err := decoder.Decode(EncodePlayers(nil, table.Players())); err != nil {
+		t.Fatalf("decoding empty player table: %v", err)
+	}
+	if len(decoder.Players) != 0 {
+		t.Fatalf("decoder kept players %v after an empty table", decoder.Players)
+	}
+
+	tick := types.GameTick{Tick: 0, Inputs: []types.PlayerInput{{PlayerID: "dave", Left: true}}}
+	decoded, err := decoder.Decode(EncodeTick(nil, tick, table))
+	if err != nil {
+		t.Fatalf("decoding first tick of the new match: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Inputs, tick.Inputs) {
+		t.Errorf("inputs decoded as %+v, want %+v", decoded.Inputs, tick.Inputs)
+	}
+	if !reflect.DeepEqual(decoder.Players, []string{"dave"}) {
+		t.Errorf("decoder players are %v, want [dave]", decoder.Players)
+	}
+}
+
+// BenchmarkEncodeTick compares encoding a tick as JSON and as a binary
+// frame for a range of player counts, reporting the size of each
+func BenchmarkEncodeTick(b *testing.B) {
+	for _, players := range []int{1, 4, 16, 64, 256} {
+		tick, table := newBenchmarkTick(players)
+		message := types.TickMessage{Type: types.MessageTypeTick, Tick: tick}
+
+		b.Run(fmt.Sprintf("json/players=%d", players), func(b *testing.B) {
+			b.ReportAllocs()
+			var data []byte
+			for range b.N {
+				data, _ = json.Marshal(message)
+			}
+			b.ReportMetric(float64(len(data)), "B/frame")
+		})
+
+		b.Run(fmt.Sprintf("binary/players=%d", players), func(b *testing.B) {
+			b.ReportAllocs()
+			var buf []byte
+			for range b.N {
+				buf = EncodeTick(buf[:0], tick, table)
+			}
+			b.ReportMetric(float64(len(buf)), "B/frame")
+		})
+	}
+}
+
+// newBenchmarkTick builds a tick with random inputs from about half of the
+// given number of players, and a player table that already knows all of
+// them, as it would mid-match
+func newBenchmarkTick(players int) (types.GameTick, *PlayerTable) {
+	random := rand.New(rand.NewSource(1))
+	table := NewPlayerTable()
+	tick := types.GameTick{Tick: 12_345}
+
+	for i := range players {
+		playerID := fmt.Sprintf("4f6b1c2e-0000-4000-8000-%012d", i)
+		table.Index(playerID)
+		if random.Intn(2) == 0 {
+			continue
+		}
+		tick.Inputs = append(tick.Inputs, types.PlayerInput{
+			PlayerID:  playerID,
+			Up:        random.Intn(2) == 0,
+			Down:      random.Intn(2) == 0,
+			Left:      random.Intn(2) == 0,
+			Right:     random.Intn(2) == 0,
+			PlaceBlob: random.Intn(8) == 0,
+		})
+	}
+	return tick, table
+}
@@ -0,0 +1,21 @@
+#!/bin/bash
+
+# Script to generate a self-signed TLS certificate for local development
+#
+# The certificate is valid for localhost and 127.0.0.1. Browsers will warn
+# about it until it is trusted, use a real certificate in production.
+
+OUT_DIR="${1:-certs}"
+DAYS="${DAYS:-365}"
+
+mkdir -p "$OUT_DIR"
+
+openssl req -x509 -newkey rsa:2048 -nodes \
+  -keyout "$OUT_DIR/key.pem" \
+  -out "$OUT_DIR/cert.pem" \
+  -days "$DAYS" \
+  -subj "/CN=localhost" \
+  -addext "subjectAltName=DNS:localhost,IP:127.0.0.1" || exit 1
+
+echo "Wrote $OUT_DIR/cert.pem and $OUT_DIR/key.pem"
+echo "Run the server with: -tls-cert $OUT_DIR/cert.pem -tls-key $OUT_DIR/key.pem"
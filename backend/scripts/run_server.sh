@@ -1,15 +1,12 @@
 #!/bin/bash
 
 # Script to start the Blobberman server with different configuration presets
-
-# Default values
-ADDR=":8080"
-VERBOSE=""
-TICK_INTERVAL="50"
-MAX_TICKS="100000"
+#
+# Presets are defined by the server's config loader (see pkg/config) and can
+# be extended in a config file. Any extra arguments are passed to the server.
 
 function show_help() {
-  echo "Usage: $0 [options] [preset]"
+  echo "Usage: $0 [options] [preset] [server flags...]"
   echo ""
   echo "Options:"
   echo "  -h, --help     Show this help message"
@@ -22,9 +19,10 @@ function show_help() {
   echo "  test           Test game"
   echo ""
   echo "Examples:"
-  echo "  $0                  # Default: 20Hz, ~30 mins"
+  echo "  $0                  # Preset from the config file or environment, else default"
   echo "  $0 quick           # Quick game: 20Hz, 5 mins"
   echo "  $0 test            # Test game: 20Hz, 1 min"
+  echo "  $0 quick -config config.yaml"
   exit 0
 }
 
@@ -33,41 +31,27 @@ if [ "$1" == "-h" ] || [ "$1" == "--help" ]; then
   show_help
 fi
 
-# Set preset configurations
-case "$1" in
-  "quick")
-    MAX_TICKS="2000"
-    RESET_TIMEOUT="5"
-    echo "Setting up a quick game"
-    ;;
-  "slow")
-    MAX_TICKS="8000"
-    TICK_INTERVAL="100"
-    echo "Setting up a slow game"
-    ;;
-  "fast")
-    MAX_TICKS="1000"
-    RESET_TIMEOUT="5"
-    echo "Setting up a fast game"
-    ;;
-  "test")
-    MAX_TICKS="500"
-    VERBOSE="-verbose"
-    RESET_TIMEOUT="5"
-    echo "Setting up a test game"
-    ;;
-  "default" | "")
-    echo "Setting up a default game (20Hz, ~30 mins)"
-    ;;
-  *)
-    echo "Unknown preset: $1"
-    show_help
-    ;;
-esac
+# Only pass -preset when one was given, so a preset selected in the config
+# file or BLOBBERMAN_PRESET isn't overridden
+PRESET_FLAGS=()
+if [ -n "$1" ] && [[ "$1" != -* ]]; then
+  PRESET="$1"
+  PRESET_FLAGS=(-preset "$PRESET")
+  shift
+
+  case "$PRESET" in
+    "default" | "quick" | "slow" | "fast" | "test")
+      echo "Setting up a $PRESET game"
+      ;;
+    *)
+      echo "Using preset $PRESET from the config file"
+      ;;
+  esac
+fi
 
 # Build and run the server
 cd "$(dirname "$0")/.."
 echo "Building server..."
 go build -o server cmd/server.go
-echo "Starting server with: -addr $ADDR -tick-interval $TICK_INTERVAL -max-ticks $MAX_TICKS $VERBOSE -reset-timeout $RESET_TIMEOUT"
-./server -addr $ADDR -tick-interval $TICK_INTERVAL -max-ticks $MAX_TICKS $VERBOSE -reset-timeout $RESET_TIMEOUT
+echo "Starting server with: ${PRESET_FLAGS[*]} $*"
+./server "${PRESET_FLAGS[@]}" "$@"
@@ -68,6 +68,8 @@ export interface PlayerState {
   speedMultiplier: number; // Multiplier for movement speed
   speedBoostEndTick: number; // Tick when the speed boost ends
   hasShield: boolean; // Whether the player has a shield
+  bombsDropped: number; // Bombs placed by the player this match
+  hitsTaken: number; // Times the player was caught in an explosion this match
   shieldEndTick: number; // Tick when the shield ends
   canJump: boolean; // Whether the player can jump
   diagonalDirection: string | null; // Track diagonal movement for rendering
@@ -76,7 +78,7 @@ export interface PlayerState {
 const GRID_SIZE = 40; // Increased from 20 to 40 for a larger game board
 const BOMB_TIMER = 60; // 3 seconds at 20 ticks per second
 const EXPLOSION_DURATION = 20; // 1 second at 20 ticks per second
-const DEFAULT_GAME_SEED = 1234567890; // Default seed to use if no players
+const DEFAULT_GAME_SEED = 1234567890; // Default seed to use if the server announces none
 
 // Power-up constants
 const POWERUP_SPAWN_CHANCE = 0.4; // 40% chance to spawn a power-up when a breakable wall is destroyed
@@ -163,8 +165,12 @@ function ensureRandomInitialized(state: GameState, tick: GameTick): void {
   }
 
   // We need a consistent seed across all clients
-  // Get the first player ID from the inputs or use a fixed default
+  // Use the seed the server announces in the first tick or a fixed default
   let seed = DEFAULT_GAME_SEED;
+  const seedEvent = tick.events?.find(event => event.kind === 'seed');
+  if (seedEvent?.value !== undefined) {
+    seed = Number(seedEvent.value);
+  }
 
   // Initialize the deterministic random generator
   initializeRandom(seed);
@@ -381,6 +387,7 @@ function checkExplosionHits(state: GameState, explosion: Explosion): void {
     // Check center of explosion
     if (playerCellX === expCellX && playerCellY === expCellY) {
       // Player is hit, reset their painted areas
+      player.hitsTaken++;
       resetPlayerPaintedAreas(state, playerId);
       continue;
     }
@@ -392,6 +399,7 @@ function checkExplosionHits(state: GameState, explosion: Explosion): void {
 
       if (playerCellX === armCellX && playerCellY === armCellY) {
         // Player is hit, reset their painted areas
+        player.hitsTaken++;
         resetPlayerPaintedAreas(state, playerId);
         break;
       }
@@ -750,7 +758,9 @@ export function processGameTick(currentState: GameState, tick: GameTick): GameSt
         hasShield: false,
         shieldEndTick: 0,
         canJump: false,
-        diagonalDirection: null
+        diagonalDirection: null,
+        bombsDropped: 0,
+        hitsTaken: 0
       });
 
       // Initialize painted count
@@ -871,6 +881,7 @@ export function processGameTick(currentState: GameState, tick: GameTick): GameSt
 
           // Increment player's active bomb count
           player.bombsPlaced++;
+          player.bombsDropped++;
         }
       }
     }
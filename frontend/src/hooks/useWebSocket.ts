@@ -7,7 +7,11 @@ import {
   InputMessage,
   HistorySyncMessage,
   ResetMessage,
-  DisplayNameUpdateMessage
+  DisplayNameUpdateMessage,
+  MatchResultMessage,
+  ClientIdMessage,
+  HelloMessage,
+  ErrorMessage
 } from '@/types/shared';
 import { ConnectionState } from '@/types/ConnectionState';
 import { ENV } from '@/utils/env';
@@ -17,6 +21,14 @@ import { usePlayerData } from './usePlayerData';
 // Get WebSocket URL from environment
 const WS_URL = ENV.WS_URL;
 
+// Protocol version we speak and the capabilities we ask the server for
+const PROTOCOL_VERSION = 2;
+const CAPABILITIES = ['compression', 'resume'];
+
+// Where the session token from the server is kept, so a reload or reconnect
+// can resume our session
+const SESSION_TOKEN_KEY = 'blobberman_session_token';
+
 export interface UseWebSocketResult {
   connectionState: ConnectionState;
   playerId: string;
@@ -173,12 +185,22 @@ export const useWebSocket = (): UseWebSocketResult => {
       console.log('WebSocket connection established');
       setConnectionState('connected');
 
+      // Negotiate the protocol before anything else
+      const helloMessage: HelloMessage = {
+        type: 'hello',
+        protocolVersion: PROTOCOL_VERSION,
+        capabilities: CAPABILITIES
+      };
+      socket.send(JSON.stringify(helloMessage));
+
       // Send our player ID to the server right after connection
       // This ensures the server uses our persistent ID instead of generating a new one
+      // The session token proves the ID is ours while our slot is held for us
       if (playerId) {
-        const playerIdMessage = {
+        const playerIdMessage: ClientIdMessage = {
           type: 'clientId',
-          playerId: playerId
+          playerId: playerId,
+          sessionToken: localStorage.getItem(SESSION_TOKEN_KEY) ?? undefined
         };
         socket.send(JSON.stringify(playerIdMessage));
         console.log(`Sent our persistent player ID to server: ${playerId}`);
@@ -191,11 +213,21 @@ export const useWebSocket = (): UseWebSocketResult => {
 
         // Handle different message types
         switch (message.type) {
+          case 'hello':
+            const helloMsg = message as HelloMessage;
+            console.log(`Negotiated protocol version ${helloMsg.protocolVersion} with capabilities: ${helloMsg.capabilities.join(', ')}`);
+            break;
+
           case 'connect':
             const connectMsg = message as ConnectMessage;
             console.log(`Connected to server with our player ID: ${playerId}`);
             console.log(`Game session info: maxTicks=${connectMsg.maxTicks}, tickInterval=${connectMsg.tickInterval}ms`);
 
+            // Keep the session token to resume our session after reconnecting
+            if (connectMsg.sessionToken) {
+              localStorage.setItem(SESSION_TOKEN_KEY, connectMsg.sessionToken);
+            }
+
             // Update game state with session information
             setGameState(() => {
                 const newState = createInitialGameState();
@@ -291,6 +323,17 @@ export const useWebSocket = (): UseWebSocketResult => {
             setPlayerDisplayNames(displayNameMsg.displayNames);
             break;
 
+          case 'error':
+            const errorMsg = message as ErrorMessage;
+            console.warn(`Server error ${errorMsg.code}: ${errorMsg.message}`);
+
+            // Our token no longer matches the session holding our ID, so
+            // start over without it once the slot is released
+            if (errorMsg.code === 'sessionInvalid') {
+              localStorage.removeItem(SESSION_TOKEN_KEY);
+            }
+            break;
+
           default:
             console.warn('Unhandled message type:', message.type);
         }
@@ -348,6 +391,26 @@ export const useWebSocket = (): UseWebSocketResult => {
     }
   }, [playerId, setDisplayName]);
 
+  // Report the final scores once the match is over, so the server can record
+  // the result the players agree on
+  useEffect(() => {
+    if (!gameState.gameOver || !socketRef.current || socketRef.current.readyState !== WebSocket.OPEN) {
+      return;
+    }
+
+    const resultMessage: MatchResultMessage = {
+      type: 'matchResult',
+      tick: gameState.tick,
+      scores: Array.from(gameState.paintedCounts.entries()).map(([id, score]) => ({
+        playerId: id,
+        score,
+        bombsDropped: gameState.players.get(id)?.bombsDropped ?? 0,
+        hitsTaken: gameState.players.get(id)?.hitsTaken ?? 0
+      }))
+    };
+    socketRef.current.send(JSON.stringify(resultMessage));
+  }, [gameState.gameOver]);
+
   // Automatically connect on component mount
   useEffect(() => {
     connect();
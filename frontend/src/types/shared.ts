@@ -11,10 +11,20 @@ export interface PlayerInput {
 // For backward compatibility and type safety
 export type Direction = 'up' | 'down' | 'left' | 'right';
 
+// Server events recorded in the tick stream
+export type GameEventKind = 'join' | 'leave' | 'nameChange' | 'admin' | 'seed' | 'chat';
+
+export interface GameEvent {
+  kind: GameEventKind;
+  playerId?: string;
+  value?: string; // Display name, admin action, seed in decimal or chat text, depending on the kind
+}
+
 // Game Tick types
 export interface GameTick {
   tick: number;
   inputs: PlayerInput[];
+  events?: GameEvent[]; // Server events that happened before this tick, in order
 }
 
 // Power-up types
@@ -35,6 +45,8 @@ export interface ConnectMessage {
   playerId: string;
   maxTicks: number;
   tickInterval: number;
+  sessionToken?: string;  // Token to resume the player's session after reconnecting
+  rating?: number;        // Player's skill rating
 }
 
 export interface InputMessage {
@@ -68,6 +80,36 @@ export type DisplayNameUpdateMessage = {
 export type ClientIdMessage = {
   type: 'clientId';
   playerId: string;       // Client's persistent player ID
+  sessionToken?: string;  // Token from the last connect message, proving the player ID is ours
+};
+
+// Sent first to negotiate the protocol version and capabilities, the server
+// answers with the ones it agreed to
+export type HelloMessage = {
+  type: 'hello';
+  protocolVersion: number;
+  capabilities: string[];
+};
+
+export type ErrorMessage = {
+  type: 'error';
+  code: string;
+  message: string;
+};
+
+export type PlayerScore = {
+  playerId: string;
+  score: number;          // Tiles painted by the player
+  bombsDropped: number;
+  hitsTaken: number;
+};
+
+// Sent once the simulation reaches the end of the match, the server records
+// the result a majority of the players agree on
+export type MatchResultMessage = {
+  type: 'matchResult';
+  tick: number;
+  scores: PlayerScore[];
 };
 
-export type GameMessage = ConnectMessage | InputMessage | TickMessage | HistorySyncMessage | ResetMessage | DisplayNameUpdateMessage | ClientIdMessage;
+export type GameMessage = ConnectMessage | InputMessage | TickMessage | HistorySyncMessage | ResetMessage | DisplayNameUpdateMessage | ClientIdMessage | HelloMessage | ErrorMessage;